@@ -2,19 +2,32 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"net/mail"
 	"os"
+	"os/exec"
+	"slices"
 	"strconv"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/d-shames3/gator/internal/config"
 	"github.com/d-shames3/gator/internal/database"
+	"github.com/d-shames3/gator/internal/htmltext"
 	"github.com/google/uuid"
 )
 
 type state struct {
 	db     *database.Queries
 	config *config.Config
+	ctx    context.Context
+	sqlDB  *sql.DB
+	format string
+	tmpl   *template.Template
 }
 
 type command struct {
@@ -63,13 +76,12 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 		UserID:    user.ID,
 	}
 
-	feed, err := s.db.CreateFeed(context.Background(), feedParams)
+	feed, err := s.db.CreateFeed(s.ctx, feedParams)
 	if err != nil {
 		return fmt.Errorf("error add feed to database: %v", err)
 	}
 
 	fmt.Printf("%s feed successfully added to database for user %s\n", feed.Name, s.config.CurrentUserName)
-	fmt.Printf("Full feed data: %v\n", feed)
 
 	followFeedParams := database.CreateFeedFollowsParams{
 		ID:        uuid.New(),
@@ -79,244 +91,1679 @@ func handlerAddFeed(s *state, cmd command, user database.User) error {
 		FeedID:    feed.ID,
 	}
 
-	_, err = s.db.CreateFeedFollows(context.Background(), followFeedParams)
+	_, err = s.db.CreateFeedFollows(s.ctx, followFeedParams)
 	if err != nil {
 		return fmt.Errorf("error creating feed follow entry for user")
 	}
 
-	fmt.Printf("%s is now following %s feed", s.config.CurrentUserName, feed.Name)
+	fmt.Printf("%s is now following %s feed\n", s.config.CurrentUserName, feed.Name)
 
 	return nil
 }
 
+// aggregatorLockID is the Postgres advisory lock key shared by all agg
+// processes. Regular instances hold it in shared mode; --singleton takes it
+// exclusively, so it can only start when no other aggregator is running and
+// blocks any from starting after it.
+const aggregatorLockID int64 = 0x6761746f72
+
 func handlerAgg(s *state, cmd command) error {
-	if len(cmd.args) == 0 {
+	aggFlags := flag.NewFlagSet("agg", flag.ContinueOnError)
+	singleton := aggFlags.Bool("singleton", false, "refuse to run alongside any other aggregator")
+	digests := aggFlags.Bool("digests", false, "send email digests as they come due")
+	err := parseFlags(aggFlags, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	args := aggFlags.Args()
+	if len(args) == 0 {
 		return fmt.Errorf("must provide a time between requests duration, formatted like 1s, 1m, 1h")
 	}
 
-	timeBetweenReqs, err := time.ParseDuration(cmd.args[0])
+	timeBetweenReqs, err := time.ParseDuration(args[0])
 	if err != nil {
 		return fmt.Errorf("error parsing time between requests duration - ensure formatting is similar to 1s, 1m, 1h, etc")
 	}
 
+	// Advisory locks belong to a session, so pin one connection for the
+	// lifetime of the aggregator instead of going through the pool.
+	conn, err := s.sqlDB.Conn(s.ctx)
+	if err != nil {
+		return fmt.Errorf("error reserving connection for aggregator lock: %v", err)
+	}
+	defer conn.Close()
+
+	lockQueries := database.New(conn)
+	if *singleton {
+		locked, err := lockQueries.TryAdvisoryLock(s.ctx, aggregatorLockID)
+		if err != nil {
+			return fmt.Errorf("error acquiring aggregator lock: %v", err)
+		}
+		if !locked {
+			return fmt.Errorf("another aggregator is already running, refusing to start in singleton mode")
+		}
+		defer lockQueries.AdvisoryUnlock(context.Background(), aggregatorLockID)
+	} else {
+		locked, err := lockQueries.TryAdvisoryLockShared(s.ctx, aggregatorLockID)
+		if err != nil {
+			return fmt.Errorf("error acquiring aggregator lock: %v", err)
+		}
+		if !locked {
+			return fmt.Errorf("a singleton aggregator is already running")
+		}
+		defer lockQueries.AdvisoryUnlockShared(context.Background(), aggregatorLockID)
+	}
+
 	ticker := time.NewTicker(timeBetweenReqs)
+	defer ticker.Stop()
 	fmt.Printf("Collecting feeds every %v\n", timeBetweenReqs)
-	for ; ; <-ticker.C {
-		err = scrapeFeeds(s.db)
+	for {
+		err = scrapeFeeds(s)
 		if err != nil {
-			return err
+			if s.ctx.Err() != nil {
+				fmt.Println("Aggregator interrupted, shutting down")
+				return nil
+			}
+			if !errors.As(err, &feedError{}) {
+				return err
+			}
+			fmt.Println(err)
+		}
+
+		if *digests {
+			err = sendDueDigests(s)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		select {
+		case <-s.ctx.Done():
+			fmt.Println("Aggregator stopped")
+			return nil
+		case <-ticker.C:
 		}
 	}
 }
 
 func handlerBrowse(s *state, cmd command, user database.User) error {
-	var err error
+	browseFlags := flag.NewFlagSet("browse", flag.ContinueOnError)
+	unread := browseFlags.Bool("unread", false, "only show posts you haven't read")
+	feedName := browseFlags.String("feed", "", "only show posts from this feed (url, name or alias)")
+	folder := browseFlags.String("folder", "", "only show posts from feeds in this folder")
+	since := browseFlags.String("since", "", "only show posts published on or after this date, e.g. 2024-01-31")
+	until := browseFlags.String("until", "", "only show posts published before this date, e.g. 2024-01-31")
+	sortBy := browseFlags.String("sort", "published", "order posts by published or fetched time")
+	offset := browseFlags.Int("offset", 0, "skip this many posts")
+	after := browseFlags.Int64("after", 0, "show posts that come after this post id, for paging")
+	err := parseFlags(browseFlags, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if *sortBy != "published" && *sortBy != "fetched" {
+		return fmt.Errorf("--sort must be either published or fetched")
+	}
+
 	limit := 2
-	if len(cmd.args) > 0 {
-		limit, err = strconv.Atoi(cmd.args[0])
+	if browseFlags.NArg() > 0 {
+		limit, err = strconv.Atoi(browseFlags.Arg(0))
 		if err != nil {
 			return fmt.Errorf("error parsing limit")
 		}
 	}
 
 	userPostParams := database.GetPostsForUserParams{
-		UserID: user.ID,
-		Limit:  int32(limit),
+		UserID:     user.ID,
+		UnreadOnly: *unread,
+		SortBy:     *sortBy,
+		RowOffset:  int32(*offset),
+		RowLimit:   int32(limit),
+	}
+
+	if *feedName != "" {
+		feed, err := getUserFeed(s, user, *feedName)
+		if err != nil {
+			return err
+		}
+		userPostParams.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	if *folder != "" {
+		userPostParams.Folder = sql.NullString{String: *folder, Valid: true}
+	}
+
+	if *since != "" {
+		sinceTime, err := parseDate(*since)
+		if err != nil {
+			return err
+		}
+		userPostParams.Since = sql.NullTime{Time: sinceTime, Valid: true}
+	}
+
+	if *until != "" {
+		untilTime, err := parseDate(*until)
+		if err != nil {
+			return err
+		}
+		userPostParams.Until = sql.NullTime{Time: untilTime, Valid: true}
+	}
+
+	if *after != 0 {
+		userPostParams.AfterID = sql.NullInt64{Int64: *after, Valid: true}
 	}
 
-	userPosts, err := s.db.GetPostsForUser(context.Background(), userPostParams)
+	userPosts, err := s.db.GetPostsForUser(s.ctx, userPostParams)
 	if err != nil {
 		return fmt.Errorf("error fetching posts for user %s: %v", s.config.CurrentUserName, err)
 	}
 
-	fmt.Printf("Successfully fetched posts for user %s!\n", s.config.CurrentUserName)
-
+	out := newListing("id", "feed", "title", "description", "url", "published_at", "status", "tags")
+	out.empty = fmt.Sprintf("No posts found for user %s", s.config.CurrentUserName)
 	for _, post := range userPosts {
-		fmt.Printf("Feed: %s, Post Title: %s, Description: %s, URL: %s, Published At: %v\n", post.FeedName, post.PostTitle, post.Description.String, post.Url, post.PublishedAt.Time)
+		status := "unread"
+		if post.ReadAt.Valid {
+			status = "read"
+		}
+		publishedAt := post.CreatedAt
+		if post.PublishedAt.Valid {
+			publishedAt = post.PublishedAt.Time
+		}
+		out.add(post.ShortID, post.FeedName, post.PostTitle, htmltext.PlainText(post.Description.String), post.Url, publishedAt, status, post.Tags)
+	}
+
+	err = out.print(s)
+	if err != nil {
+		return err
+	}
+
+	if len(userPosts) == limit && s.format == "table" {
+		fmt.Printf("For the next page, run browse with --after %d\n", userPosts[len(userPosts)-1].ShortID)
 	}
 
 	return nil
 }
 
+func handlerDigest(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("must provide a subcommand: subscribe, unsubscribe or send")
+	}
+
+	args := cmd.args[1:]
+	switch cmd.args[0] {
+	case "subscribe":
+		subscribeFlags := flag.NewFlagSet("digest subscribe", flag.ContinueOnError)
+		every := subscribeFlags.String("every", "daily", "how often to send the digest: daily or weekly")
+		err := parseFlags(subscribeFlags, args)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := digestFrequencies[*every]; !ok {
+			return fmt.Errorf("--every must be either daily or weekly")
+		}
+		if subscribeFlags.NArg() == 0 {
+			return fmt.Errorf("usage: digest subscribe [--every daily|weekly] <email>")
+		}
+		address, err := mail.ParseAddress(subscribeFlags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("error parsing email address %s: %v", subscribeFlags.Arg(0), err)
+		}
+
+		err = s.db.SetUserDigest(s.ctx, database.SetUserDigestParams{
+			ID:              user.ID,
+			Email:           sql.NullString{String: address.Address, Valid: true},
+			DigestFrequency: sql.NullString{String: *every, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error saving digest settings for %s: %v", user.Name, err)
+		}
+
+		fmt.Printf("User %s will get a %s digest at %s\n", user.Name, *every, address.Address)
+		return nil
+	case "unsubscribe":
+		err := s.db.SetUserDigest(s.ctx, database.SetUserDigestParams{ID: user.ID})
+		if err != nil {
+			return fmt.Errorf("error saving digest settings for %s: %v", user.Name, err)
+		}
+
+		fmt.Printf("User %s will no longer get digests\n", user.Name)
+		return nil
+	case "send":
+		sendFlags := flag.NewFlagSet("digest send", flag.ContinueOnError)
+		dryRun := sendFlags.Bool("dry-run", false, "print the emails instead of sending them")
+		now := sendFlags.Bool("now", false, "send your digest now, even if it isn't due")
+		err := parseFlags(sendFlags, args)
+		if err != nil {
+			return err
+		}
+
+		if !user.Email.Valid || !user.DigestFrequency.Valid {
+			return fmt.Errorf("user %s has no digest email, run digest subscribe first", user.Name)
+		}
+		if !*now {
+			due, err := digestDue(s, user)
+			if err != nil {
+				return err
+			}
+			if !due {
+				fmt.Printf("Digest for %s isn't due yet, use --now to send it anyway\n", user.Name)
+				return nil
+			}
+		}
+		return sendDigest(s, user, *dryRun)
+	default:
+		return fmt.Errorf("unknown digest subcommand %s, use subscribe, unsubscribe or send", cmd.args[0])
+	}
+}
+
+func handlerExport(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("must provide what to export: opml or user")
+	}
+
+	switch cmd.args[0] {
+	case "opml":
+		return exportOPML(s, user, cmd.args[1:])
+	case "user":
+		return exportUser(s, user, cmd.args[1:])
+	default:
+		return fmt.Errorf("unknown export type %s, use opml or user", cmd.args[0])
+	}
+}
+
 func handlerFeeds(s *state, cmd command) error {
-	feeds, err := s.db.GetFeeds(context.Background())
+	if len(cmd.args) > 0 && cmd.args[0] == "gc" {
+		return handlerFeedsGC(s, command{cmd.name + " gc", cmd.args[1:]})
+	}
+
+	feeds, err := s.db.GetFeeds(s.ctx)
 	if err != nil {
 		return fmt.Errorf("error fetching feeds from database: %v", err)
 	}
 
+	out := newListing("name", "url", "user")
+	out.empty = "No feeds have been added yet"
 	for _, feed := range feeds {
-		fmt.Printf("* feed: %s, url: %s, user: %s\n", feed.Feed, feed.Url, feed.User)
+		out.add(feed.Feed, feed.Url, feed.User)
 	}
 
-	return nil
+	return out.print(s)
 }
 
-func handlerFollow(s *state, cmd command, user database.User) error {
-	if len(cmd.args) == 0 {
-		return fmt.Errorf("must provide feed url")
+// handlerFeedsGC deletes feeds that have had no followers for longer than
+// the grace period, along with their posts. Starred posts are never pruned,
+// so a feed with starred posts keeps those posts and stays orphaned.
+func handlerFeedsGC(s *state, cmd command) error {
+	gcFlags := flag.NewFlagSet("feeds gc", flag.ContinueOnError)
+	grace := gcFlags.Duration("grace", 30*24*time.Hour, "how long a feed must be orphaned before it is deleted")
+	dryRun := gcFlags.Bool("dry-run", false, "list feeds that would be deleted without deleting them")
+	err := parseFlags(gcFlags, cmd.args)
+	if err != nil {
+		return err
 	}
 
-	feed, err := s.db.GetFeed(context.Background(), cmd.args[0])
+	err = syncOrphanedFeeds(s)
 	if err != nil {
-		return fmt.Errorf("feed not found, must add feed before following")
+		return err
+	}
+
+	graceSeconds := grace.Seconds()
+	if *dryRun {
+		orphans, err := s.db.GetOrphanedFeeds(s.ctx, graceSeconds)
+		if err != nil {
+			return fmt.Errorf("error fetching orphaned feeds: %v", err)
+		}
+
+		out := newListing("name", "url", "orphaned_at", "starred_posts_kept")
+		out.empty = "No orphaned feeds would be pruned"
+		for _, orphan := range orphans {
+			out.add(orphan.Name, orphan.Url, orphan.OrphanedAt, orphan.StarredPosts)
+		}
+		return out.print(s)
 	}
 
-	feeds, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	tx, err := s.sqlDB.BeginTx(s.ctx, nil)
 	if err != nil {
-		fmt.Println("user is not yet following any feeds")
+		return fmt.Errorf("error starting transaction: %v", err)
 	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
 
-	for _, userFeed := range feeds {
-		if feed.ID == userFeed.ID {
-			return fmt.Errorf("user is already following %s feed", feed.Name)
-		}
+	deletedPosts, err := qtx.DeleteOrphanedPosts(s.ctx, graceSeconds)
+	if err != nil {
+		return fmt.Errorf("error deleting posts of orphaned feeds: %v", err)
 	}
 
-	followFeedParams := database.CreateFeedFollowsParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		UserID:    user.ID,
-		FeedID:    feed.ID,
+	deleted, err := qtx.DeleteOrphanedFeeds(s.ctx, graceSeconds)
+	if err != nil {
+		return fmt.Errorf("error deleting orphaned feeds: %v", err)
 	}
 
-	feedFollow, err := s.db.CreateFeedFollows(context.Background(), followFeedParams)
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("error following feed: %v", err)
+		return fmt.Errorf("error committing feeds gc: %v", err)
+	}
+
+	fmt.Printf("Deleted %d orphaned feeds and %d posts\n", len(deleted), deletedPosts)
+	for _, feed := range deleted {
+		fmt.Printf("* feed: %s, url: %s\n", feed.Name, feed.Url)
 	}
 
-	fmt.Printf("User %s successfully followed feed %s!\n", feedFollow.User, feedFollow.Feed)
 	return nil
 }
 
-func handlerFollowing(s *state, cmd command, user database.User) error {
-	feedsFollowing, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+func handlerFetch(s *state, cmd command) error {
+	fetchFlags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	all := fetchFlags.Bool("all", false, "fetch every followed feed once")
+	err := parseFlags(fetchFlags, cmd.args)
 	if err != nil {
 		return err
 	}
 
-	if len(feedsFollowing) == 0 {
-		fmt.Printf("User %s is not following any feeds\n", s.config.CurrentUserName)
+	if *all {
+		feeds, err := s.db.GetFollowedFeeds(s.ctx)
+		if err != nil {
+			return fmt.Errorf("error fetching followed feeds: %v", err)
+		}
+
+		failed := 0
+		for _, feed := range feeds {
+			err = fetchNow(s, feed)
+			if s.ctx.Err() != nil {
+				return err
+			}
+			if err != nil {
+				fmt.Println(err)
+				failed++
+			}
+		}
+
+		fmt.Printf("Fetched %d feeds, %d failed\n", len(feeds)-failed, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d feeds failed to fetch", failed, len(feeds))
+		}
 		return nil
 	}
 
-	fmt.Printf("User %s is following these feeds:\n", s.config.CurrentUserName)
-	for _, feed := range feedsFollowing {
-		fmt.Printf("* %s\n", feed.Feed)
+	if fetchFlags.NArg() == 0 {
+		return fmt.Errorf("must provide a feed url or name, or --all")
 	}
 
-	return nil
+	feed, err := s.db.GetFeedByURLOrName(s.ctx, fetchFlags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("feed %s not found, must add feed before fetching", fetchFlags.Arg(0))
+	}
+
+	return fetchNow(s, feed)
 }
 
-func handlerLogin(s *state, cmd command) error {
-	if len(cmd.args) == 0 {
-		return fmt.Errorf("no username arg provided for login")
+// fetchNow scrapes a feed outside agg's rotation, marking it fetched so agg
+// doesn't immediately fetch it again.
+func fetchNow(s *state, feed database.Feed) error {
+	feed, err := s.db.MarkFeedFetched(s.ctx, feed.ID)
+	if err != nil {
+		return fmt.Errorf("error marking feed as fetched: %v", err)
 	}
 
-	_, err := s.db.GetUser(context.Background(), cmd.args[0])
+	return scrapeFeed(s, feed)
+}
+
+func handlerFetchLog(s *state, cmd command) error {
+	fetchLogFlags := flag.NewFlagSet("fetchlog", flag.ContinueOnError)
+	limit := fetchLogFlags.Int("limit", 20, "number of attempts to show")
+	err := parseFlags(fetchLogFlags, cmd.args)
 	if err != nil {
-		fmt.Println("cannot login as an unregistered user - please register first")
-		os.Exit(1)
-		return nil
+		return err
 	}
 
-	err = s.config.SetUser(cmd.args[0])
+	fetchLogParams := database.GetFetchLogParams{
+		RowLimit: int32(*limit),
+	}
+
+	if fetchLogFlags.NArg() > 0 {
+		feed, err := s.db.GetFeedByURLOrName(s.ctx, fetchLogFlags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("feed %s not found", fetchLogFlags.Arg(0))
+		}
+		fetchLogParams.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	attempts, err := s.db.GetFetchLog(s.ctx, fetchLogParams)
 	if err != nil {
-		return err
+		return fmt.Errorf("error fetching fetch log: %v", err)
 	}
 
-	fmt.Printf("Successfully logged in as user %s!\n", cmd.args[0])
-	return nil
+	out := newListing("started_at", "feed", "http_status", "duration_ms", "bytes", "items_seen", "new_posts", "error")
+	out.empty = "No fetch attempts recorded yet"
+	for _, attempt := range attempts {
+		out.add(attempt.StartedAt, attempt.Feed, attempt.HttpStatus, attempt.DurationMs, attempt.Bytes, attempt.ItemsSeen, attempt.NewPosts, attempt.Error)
+	}
+
+	return out.print(s)
 }
 
-func handlerRegister(s *state, cmd command) error {
+func handlerFolder(s *state, cmd command, user database.User) error {
 	if len(cmd.args) == 0 {
-		return fmt.Errorf("no username provided for registration")
+		return fmt.Errorf("must provide a subcommand: add, rm or ls")
 	}
 
-	registerUserParams := database.CreateUserParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		Name:      cmd.args[0],
-	}
+	switch cmd.args[0] {
+	case "add":
+		if len(cmd.args) < 3 {
+			return fmt.Errorf("usage: folder add <folder> <feed url, name or alias>")
+		}
+		return setFolder(s, user, cmd.args[2], sql.NullString{String: cmd.args[1], Valid: true})
+	case "rm":
+		if len(cmd.args) < 2 {
+			return fmt.Errorf("usage: folder rm <feed url, name or alias>")
+		}
+		return setFolder(s, user, cmd.args[1], sql.NullString{})
+	case "ls":
+		feedsFollowing, err := s.db.GetFeedFollowsForUser(s.ctx, user.ID)
+		if err != nil {
+			return err
+		}
 
-	_, err := s.db.GetUser(context.Background(), registerUserParams.Name)
-	if err == nil {
-		fmt.Println("User already registered")
-		os.Exit(1)
-		return nil
-	}
+		var folders []string
+		counts := make(map[string]int)
+		for _, feed := range feedsFollowing {
+			if !feed.Folder.Valid {
+				continue
+			}
+			if counts[feed.Folder.String] == 0 {
+				folders = append(folders, feed.Folder.String)
+			}
+			counts[feed.Folder.String]++
+		}
 
-	user, err := s.db.CreateUser(context.Background(), registerUserParams)
-	if err != nil {
-		return fmt.Errorf("error registering user: %v", err)
+		out := newListing("folder", "feeds")
+		out.empty = fmt.Sprintf("User %s has no folders", user.Name)
+		for _, folder := range folders {
+			out.add(folder, counts[folder])
+		}
+		return out.print(s)
+	default:
+		return fmt.Errorf("unknown folder subcommand %s, use add, rm or ls", cmd.args[0])
 	}
+}
 
-	err = s.config.SetUser(user.Name)
+// setFolder moves one of the user's follows into folder, or out of any
+// folder when folder is NULL.
+func setFolder(s *state, user database.User, feedArg string, folder sql.NullString) error {
+	feed, err := getUserFeed(s, user, feedArg)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("User %s was created!\n", user.Name)
-	fmt.Printf("%s user data: %v\n", user.Name, user)
-	return nil
-}
+	folderParams := database.SetFeedFollowFolderParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+		Folder: folder,
+	}
 
-func handlerReset(s *state, cmd command) error {
-	err := s.db.DeleteUsers(context.Background())
+	updated, err := s.db.SetFeedFollowFolder(s.ctx, folderParams)
 	if err != nil {
-		fmt.Printf("error resetting users: %v", err)
-		os.Exit(1)
-		return nil
+		return fmt.Errorf("error updating folder for feed %s: %v", feed.Name, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user %s is not following %s feed", user.Name, feed.Name)
 	}
 
-	fmt.Println("Successfully reset all users!")
+	if folder.Valid {
+		fmt.Printf("Moved feed %s into folder %s\n", feed.Name, folder.String)
+	} else {
+		fmt.Printf("Removed feed %s from its folder\n", feed.Name)
+	}
 	return nil
 }
 
-func handlerUnfollow(s *state, cmd command, user database.User) error {
+func handlerFollow(s *state, cmd command, user database.User) error {
 	if len(cmd.args) == 0 {
-		return fmt.Errorf("no feed url provided to unfollow")
+		return fmt.Errorf("must provide feed url")
 	}
 
-	feed, err := s.db.GetFeed(context.Background(), cmd.args[0])
+	feed, err := s.db.GetFeed(s.ctx, cmd.args[0])
 	if err != nil {
-		return fmt.Errorf("error fetching feed: %v", err)
+		return fmt.Errorf("feed not found, must add feed before following")
 	}
 
-	unfollowParams := database.DeleteFeedFollowForUserParams{
-		UserID: user.ID,
-		FeedID: feed.ID,
+	feeds, err := s.db.GetFeedFollowsForUser(s.ctx, user.ID)
+	if err != nil {
+		fmt.Println("user is not yet following any feeds")
+	}
+
+	for _, userFeed := range feeds {
+		if feed.ID == userFeed.FeedID {
+			return fmt.Errorf("user is already following %s feed", feed.Name)
+		}
+	}
+
+	followFeedParams := database.CreateFeedFollowsParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
 	}
 
-	err = s.db.DeleteFeedFollowForUser(context.Background(), unfollowParams)
+	feedFollow, err := s.db.CreateFeedFollows(s.ctx, followFeedParams)
 	if err != nil {
-		return fmt.Errorf("error deleting feed %s for user %s", feed.Name, user.Name)
+		return fmt.Errorf("error following feed: %v", err)
 	}
 
-	fmt.Printf("User %s is no longer following feed %s\n", user.Name, feed.Name)
+	fmt.Printf("User %s successfully followed feed %s!\n", feedFollow.User, feedFollow.Feed)
 	return nil
 }
 
-func handlerUsers(s *state, cmd command) error {
-	currentUser := s.config.CurrentUserName
+func handlerFollowing(s *state, cmd command, user database.User) error {
+	feedsFollowing, err := s.db.GetFeedFollowsForUser(s.ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	out := newListing("folder", "feed", "url", "unread")
+	out.empty = fmt.Sprintf("User %s is not following any feeds", s.config.CurrentUserName)
+	for _, feed := range feedsFollowing {
+		out.add(feed.Folder, feed.Feed, feed.Url, feed.Unread)
+	}
+
+	return out.print(s)
+}
+
+// handlerImport doesn't need a login for import user, which can restore a
+// user into an empty database; everything else imports into the current
+// user.
+func handlerImport(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("must provide what to import: opml, greader, miniflux, newsboat or user")
+	}
+	if cmd.args[0] == "user" {
+		return importUser(s, cmd.args[1:])
+	}
+	return middlewareLoggedIn(handlerImportFeeds)(s, cmd)
+}
+
+// handlerImportFeeds runs the imports other than import user, which need a
+// logged in user to follow the feeds.
+func handlerImportFeeds(s *state, cmd command, user database.User) error {
+	switch cmd.args[0] {
+	case "opml":
+		return importOPML(s, user, cmd.args[1:])
+	case "greader", "freshrss", "inoreader":
+		return importHistory(s, user, cmd.args[0], cmd.args[1:], parseGReader)
+	case "miniflux":
+		return importHistory(s, user, cmd.args[0], cmd.args[1:], parseMiniflux)
+	case "newsboat":
+		return importNewsboat(s, user, cmd.args[1:])
+	default:
+		return fmt.Errorf("unknown import type %s, use opml, greader, miniflux, newsboat or user", cmd.args[0])
+	}
+}
 
-	users, err := s.db.GetUsers(context.Background())
+func handlerLater(s *state, cmd command, user database.User) error {
+	laterFlags := flag.NewFlagSet("later", flag.ContinueOnError)
+	until := laterFlags.String("until", "", "hide the post from the queue until this date, e.g. 2024-01-31")
+	remove := laterFlags.Bool("remove", false, "take the post out of the queue")
+	err := parseFlags(laterFlags, cmd.args)
 	if err != nil {
-		return fmt.Errorf("error fetching users: %v", err)
+		return err
 	}
 
-	if len(users) == 0 {
-		return fmt.Errorf("no users to list")
+	post, err := getPostArg(s, user, command{cmd.name, laterFlags.Args()})
+	if err != nil {
+		return err
 	}
 
-	for _, user := range users {
-		if user == currentUser {
-			user += " (current)"
+	if *remove {
+		unqueueParams := database.UnqueuePostParams{
+			UserID: user.ID,
+			PostID: post.ID,
+		}
+
+		err = s.db.UnqueuePost(s.ctx, unqueueParams)
+		if err != nil {
+			return fmt.Errorf("error removing post %d from queue: %v", post.ShortID, err)
 		}
-		fmt.Printf("* %s\n", user)
+
+		fmt.Printf("Removed post %d (%s) from your read-later queue\n", post.ShortID, post.Title)
+		return nil
 	}
 
-	return nil
+	queueParams := database.QueuePostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	if *until != "" {
+		snoozedUntil, err := parseDate(*until)
+		if err != nil {
+			return err
+		}
+		queueParams.SnoozedUntil = sql.NullTime{Time: snoozedUntil, Valid: true}
+	}
+
+	err = s.db.QueuePost(s.ctx, queueParams)
+	if err != nil {
+		return fmt.Errorf("error queueing post %d: %v", post.ShortID, err)
+	}
+
+	fmt.Printf("Added post %d (%s) to your read-later queue\n", post.ShortID, post.Title)
+	return nil
+}
+
+func handlerLogin(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("no username arg provided for login")
+	}
+
+	_, err := s.db.GetUser(s.ctx, cmd.args[0])
+	if err != nil {
+		fmt.Println("cannot login as an unregistered user - please register first")
+		os.Exit(1)
+		return nil
+	}
+
+	err = s.config.SetUser(cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully logged in as user %s!\n", cmd.args[0])
+	return nil
+}
+
+func handlerMarkRead(s *state, cmd command, user database.User) error {
+	markReadFlags := flag.NewFlagSet("markread", flag.ContinueOnError)
+	feedName := markReadFlags.String("feed", "", "only mark posts from this feed (url, name or alias)")
+	before := markReadFlags.String("before", "", "only mark posts published before this date, e.g. 2024-01-31")
+	all := markReadFlags.Bool("all", false, "mark every post in your followed feeds")
+	err := parseFlags(markReadFlags, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	if *feedName == "" && *before == "" && !*all {
+		return fmt.Errorf("must provide --feed, --before or --all")
+	}
+
+	markReadParams := database.MarkPostsReadParams{
+		UserID: user.ID,
+	}
+
+	if *feedName != "" {
+		feed, err := getUserFeed(s, user, *feedName)
+		if err != nil {
+			return err
+		}
+		markReadParams.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	if *before != "" {
+		beforeTime, err := parseDate(*before)
+		if err != nil {
+			return err
+		}
+		markReadParams.Before = sql.NullTime{Time: beforeTime, Valid: true}
+	}
+
+	marked, err := s.db.MarkPostsRead(s.ctx, markReadParams)
+	if err != nil {
+		return fmt.Errorf("error marking posts read: %v", err)
+	}
+
+	fmt.Printf("Marked %d posts as read\n", marked)
+	return nil
+}
+
+func handlerNotify(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("must provide a subcommand: add, ls, rm, test or log")
+	}
+
+	args := cmd.args[1:]
+	switch cmd.args[0] {
+	case "add":
+		addFlags := flag.NewFlagSet("notify add", flag.ContinueOnError)
+		kind := addFlags.String("kind", "webhook", "sink type: "+strings.Join(notifyKinds, ", "))
+		keyword := addFlags.String("keyword", "", "only notify about posts whose title or description mention this")
+		err := parseFlags(addFlags, args)
+		if err != nil {
+			return err
+		}
+
+		if !slices.Contains(notifyKinds, *kind) {
+			return fmt.Errorf("--kind must be one of %s", strings.Join(notifyKinds, ", "))
+		}
+		if addFlags.NArg() == 0 {
+			return fmt.Errorf("usage: notify add [--kind kind] [--keyword keyword] <url or command name>")
+		}
+		target := strings.Join(addFlags.Args(), " ")
+		err = validateNotifyTarget(*kind, target)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.config.NotifyCommands[target]; *kind == "exec" && !ok {
+			return fmt.Errorf("no command named %s in the config file's notify_commands", target)
+		}
+
+		sinkParams := database.CreateNotifySinkParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			Kind:      *kind,
+			Target:    target,
+		}
+		if *keyword != "" {
+			sinkParams.Keyword = sql.NullString{String: *keyword, Valid: true}
+		}
+
+		sink, err := s.db.CreateNotifySink(s.ctx, sinkParams)
+		if err != nil {
+			return fmt.Errorf("error creating notification sink: %v", err)
+		}
+
+		fmt.Printf("Added %s notification %d, run notify test %d to try it\n", sink.Kind, sink.ShortID, sink.ShortID)
+		return nil
+	case "ls":
+		sinks, err := s.db.GetNotifySinksForUser(s.ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("error fetching notifications for user %s: %v", user.Name, err)
+		}
+
+		out := newListing("id", "kind", "target", "keyword")
+		out.empty = fmt.Sprintf("User %s has no notifications", user.Name)
+		for _, sink := range sinks {
+			out.add(sink.ShortID, sink.Kind, sink.Target, sink.Keyword)
+		}
+		return out.print(s)
+	case "rm":
+		shortID, err := parseShortIDArg(args, "notification")
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.db.DeleteNotifySink(s.ctx, database.DeleteNotifySinkParams{UserID: user.ID, ShortID: shortID})
+		if err != nil {
+			return fmt.Errorf("error deleting notification %d: %v", shortID, err)
+		}
+		if deleted == 0 {
+			return fmt.Errorf("notification %d not found", shortID)
+		}
+
+		fmt.Printf("Deleted notification %d\n", shortID)
+		return nil
+	case "test":
+		shortID, err := parseShortIDArg(args, "notification")
+		if err != nil {
+			return err
+		}
+
+		sink, err := s.db.GetNotifySinkByShortID(s.ctx, database.GetNotifySinkByShortIDParams{UserID: user.ID, ShortID: shortID})
+		if err != nil {
+			return fmt.Errorf("notification %d not found", shortID)
+		}
+
+		payload := newNotifyPayload(user.Name, "gator", database.Post{
+			Title: "Test notification from gator",
+			Url:   "https://github.com/d-shames3/gator",
+		})
+		payload.Event = "test"
+		err = deliverNotification(s, s.ctx, sink, uuid.NullUUID{}, payload)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Delivered test notification to %d\n", shortID)
+		return nil
+	case "log":
+		logFlags := flag.NewFlagSet("notify log", flag.ContinueOnError)
+		limit := logFlags.Int("limit", 20, "number of deliveries to show")
+		err := parseFlags(logFlags, args)
+		if err != nil {
+			return err
+		}
+
+		deliveries, err := s.db.GetNotifyLog(s.ctx, database.GetNotifyLogParams{UserID: user.ID, RowLimit: int32(*limit)})
+		if err != nil {
+			return fmt.Errorf("error fetching notification log: %v", err)
+		}
+
+		out := newListing("attempted_at", "notification", "kind", "post", "attempts", "error")
+		out.empty = "No notifications have been sent yet"
+		for _, delivery := range deliveries {
+			out.add(delivery.AttemptedAt, delivery.SinkID, delivery.Kind, delivery.PostTitle, delivery.Attempts, delivery.Error)
+		}
+		return out.print(s)
+	default:
+		return fmt.Errorf("unknown notify subcommand %s, use add, ls, rm, test or log", cmd.args[0])
+	}
+}
+
+func handlerOpen(s *state, cmd command, user database.User) error {
+	openFlags := flag.NewFlagSet("open", flag.ContinueOnError)
+	nextUnread := openFlags.Bool("next-unread", false, "open the newest post you haven't read")
+	comments := openFlags.Bool("comments", false, "open the post's comments page instead of the post")
+	err := parseFlags(openFlags, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	var post database.Post
+	if *nextUnread {
+		unreadParams := database.GetPostsForUserParams{
+			UserID:     user.ID,
+			UnreadOnly: true,
+			SortBy:     "published",
+			RowLimit:   1,
+		}
+
+		unreadPosts, err := s.db.GetPostsForUser(s.ctx, unreadParams)
+		if err != nil {
+			return fmt.Errorf("error fetching unread posts: %v", err)
+		}
+		if len(unreadPosts) == 0 {
+			fmt.Println("No unread posts left")
+			return nil
+		}
+
+		post, err = s.db.GetPostByShortID(s.ctx, database.GetPostByShortIDParams{
+			ShortID: unreadPosts[0].ShortID,
+			UserID:  user.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("error fetching post %d: %v", unreadPosts[0].ShortID, err)
+		}
+	} else {
+		post, err = getPostArg(s, user, command{cmd.name, openFlags.Args()})
+		if err != nil {
+			return err
+		}
+	}
+
+	link := post.Url
+	if *comments {
+		if !post.CommentsUrl.Valid {
+			return fmt.Errorf("feed doesn't provide a comments link for post %d", post.ShortID)
+		}
+		link = post.CommentsUrl.String
+	}
+
+	err = openInBrowser(s.config.BrowserCommand(), link)
+	if err != nil {
+		return err
+	}
+
+	readParams := database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	err = s.db.MarkPostRead(s.ctx, readParams)
+	if err != nil {
+		return fmt.Errorf("error marking post %d read: %v", post.ShortID, err)
+	}
+
+	fmt.Printf("Opened post %d (%s)\n", post.ShortID, post.Title)
+	return nil
+}
+
+// openInBrowser runs browser with link. Like $BROWSER, browser may list
+// several commands separated by colons (the first is used) and may contain
+// %s where the link goes; otherwise the link is appended as the last arg.
+func openInBrowser(browser, link string) error {
+	browser = strings.Split(browser, ":")[0]
+	args := strings.Fields(browser)
+	if len(args) == 0 {
+		return fmt.Errorf("no browser command configured")
+	}
+
+	if strings.Contains(browser, "%s") {
+		for i, arg := range args {
+			args[i] = strings.ReplaceAll(arg, "%s", link)
+		}
+	} else {
+		args = append(args, link)
+	}
+
+	browserCmd := exec.Command(args[0], args[1:]...)
+	browserCmd.Stdin = os.Stdin
+	browserCmd.Stdout = os.Stdout
+	browserCmd.Stderr = os.Stderr
+	err := browserCmd.Run()
+	if err != nil {
+		return fmt.Errorf("error opening %s with %s: %v", link, args[0], err)
+	}
+
+	return nil
+}
+
+func handlerPreview(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("must provide feed url")
+	}
+
+	rssFeed, _, err := fetchFeed(s.ctx, cmd.args[0], s.config.MaxFeedSize())
+	if err != nil {
+		return err
+	}
+
+	if s.format == "table" {
+		fmt.Printf("Feed: %s (%s)\n", rssFeed.Channel.Title, rssFeed.Channel.Link)
+		if rssFeed.Channel.Description != "" {
+			fmt.Println(htmltext.PlainText(rssFeed.Channel.Description))
+		}
+		fmt.Printf("%d items:\n", len(rssFeed.Channel.Item))
+	}
+
+	out := newListing("title", "url", "published_at", "author", "categories")
+	for _, item := range rssFeed.Channel.Item {
+		out.add(item.Title, item.Link, item.PubDate, itemAuthor(item), item.Categories)
+	}
+
+	return out.print(s)
+}
+
+func handlerPublish(s *state, cmd command, user database.User) error {
+	publishFlagSet := flag.NewFlagSet("publish", flag.ContinueOnError)
+	feedFlags := addPublishFlags(publishFlagSet)
+	out := publishFlagSet.String("out", "", "write to this file instead of stdout")
+	err := parseFlags(publishFlagSet, cmd.args)
+	if err != nil {
+		return err
+	}
+	err = feedFlags.validate()
+	if err != nil {
+		return err
+	}
+
+	published, err := publishFeed(s.ctx, s, user, feedFlags)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(published.body)
+		return err
+	}
+	err = os.WriteFile(*out, published.body, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", *out, err)
+	}
+	fmt.Printf("Published %d posts to %s\n", published.posts, *out)
+	return nil
+}
+
+func handlerQueue(s *state, cmd command, user database.User) error {
+	queueFlags := flag.NewFlagSet("queue", flag.ContinueOnError)
+	all := queueFlags.Bool("all", false, "include posts that are still snoozed")
+	err := parseFlags(queueFlags, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	queueParams := database.GetQueuedPostsParams{
+		UserID:         user.ID,
+		IncludeSnoozed: *all,
+	}
+
+	queued, err := s.db.GetQueuedPosts(s.ctx, queueParams)
+	if err != nil {
+		return fmt.Errorf("error fetching read-later queue: %v", err)
+	}
+
+	out := newListing("id", "feed", "title", "url", "queued_at", "snoozed_until")
+	out.empty = fmt.Sprintf("User %s has nothing in their read-later queue", user.Name)
+	for _, post := range queued {
+		out.add(post.ShortID, post.FeedName, post.PostTitle, post.Url, post.QueuedAt, post.SnoozedUntil)
+	}
+
+	return out.print(s)
+}
+
+func handlerRead(s *state, cmd command, user database.User) error {
+	post, err := getPostArg(s, user, cmd)
+	if err != nil {
+		return err
+	}
+
+	readParams := database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	err = s.db.MarkPostRead(s.ctx, readParams)
+	if err != nil {
+		return fmt.Errorf("error marking post %d read: %v", post.ShortID, err)
+	}
+
+	fmt.Printf("Marked post %d (%s) as read\n", post.ShortID, post.Title)
+	return nil
+}
+
+func handlerRegister(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("no username provided for registration")
+	}
+
+	registerUserParams := database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      cmd.args[0],
+	}
+
+	_, err := s.db.GetUser(s.ctx, registerUserParams.Name)
+	if err == nil {
+		fmt.Println("User already registered")
+		os.Exit(1)
+		return nil
+	}
+
+	user, err := s.db.CreateUser(s.ctx, registerUserParams)
+	if err != nil {
+		return fmt.Errorf("error registering user: %v", err)
+	}
+
+	err = s.config.SetUser(user.Name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s was created!\n", user.Name)
+	return nil
+}
+
+func handlerRenameFollow(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("usage: rename-follow <feed url, name or alias> [alias]")
+	}
+
+	feed, err := getUserFeed(s, user, cmd.args[0])
+	if err != nil {
+		return err
+	}
+
+	aliasParams := database.SetFeedFollowAliasParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+	}
+	if len(cmd.args) > 1 {
+		aliasParams.Alias = sql.NullString{String: cmd.args[1], Valid: true}
+	}
+
+	updated, err := s.db.SetFeedFollowAlias(s.ctx, aliasParams)
+	if err != nil {
+		return fmt.Errorf("error renaming feed %s: %v", feed.Name, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("user %s is not following %s feed", user.Name, feed.Name)
+	}
+
+	if aliasParams.Alias.Valid {
+		fmt.Printf("Feed %s will be shown as %s for user %s\n", feed.Name, aliasParams.Alias.String, user.Name)
+	} else {
+		fmt.Printf("Feed %s will be shown under its own name for user %s\n", feed.Name, user.Name)
+	}
+	return nil
+}
+
+func handlerReset(s *state, cmd command) error {
+	err := s.db.DeleteUsers(s.ctx)
+	if err != nil {
+		fmt.Printf("error resetting users: %v", err)
+		os.Exit(1)
+		return nil
+	}
+
+	fmt.Println("Successfully reset all users!")
+	return nil
+}
+
+func handlerRule(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("must provide a subcommand: add, ls, rm, test or apply")
+	}
+
+	args := cmd.args[1:]
+	switch cmd.args[0] {
+	case "add":
+		addFlags := flag.NewFlagSet("rule add", flag.ContinueOnError)
+		rf := addRuleFlags(addFlags)
+		err := parseFlags(addFlags, args)
+		if err != nil {
+			return err
+		}
+
+		ruleParams, err := rf.rule(s, user, addFlags)
+		if err != nil {
+			return err
+		}
+		ruleParams.ID = uuid.New()
+		ruleParams.CreatedAt = time.Now()
+		ruleParams.UpdatedAt = time.Now()
+
+		rule, err := s.db.CreateRule(s.ctx, ruleParams)
+		if err != nil {
+			return fmt.Errorf("error creating rule: %v", err)
+		}
+
+		fmt.Printf("Added rule %d, run rule apply %d to apply it to existing posts\n", rule.ShortID, rule.ShortID)
+		return nil
+	case "ls":
+		rules, err := s.db.GetRulesForUser(s.ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("error fetching rules for user %s: %v", user.Name, err)
+		}
+
+		out := newListing("id", "feed", "field", "match", "pattern", "action", "tag")
+		out.empty = fmt.Sprintf("User %s has no rules", user.Name)
+		for _, rule := range rules {
+			out.add(rule.ShortID, rule.Feed, rule.Field, rule.MatchType, rule.Pattern, rule.Action, rule.Tag)
+		}
+		return out.print(s)
+	case "rm":
+		shortID, err := parseShortIDArg(args, "rule")
+		if err != nil {
+			return err
+		}
+
+		deleted, err := s.db.DeleteRule(s.ctx, database.DeleteRuleParams{UserID: user.ID, ShortID: shortID})
+		if err != nil {
+			return fmt.Errorf("error deleting rule %d: %v", shortID, err)
+		}
+		if deleted == 0 {
+			return fmt.Errorf("rule %d not found", shortID)
+		}
+
+		fmt.Printf("Deleted rule %d\n", shortID)
+		return nil
+	case "test":
+		testFlags := flag.NewFlagSet("rule test", flag.ContinueOnError)
+		rf := addRuleFlags(testFlags)
+		limit := testFlags.Int("limit", 20, "number of matching posts to show")
+		err := parseFlags(testFlags, args)
+		if err != nil {
+			return err
+		}
+
+		ruleParams, err := rf.rule(s, user, testFlags)
+		if err != nil {
+			return err
+		}
+		rule, err := compileRule(database.Rule{
+			UserID:    ruleParams.UserID,
+			FeedID:    ruleParams.FeedID,
+			Field:     ruleParams.Field,
+			MatchType: ruleParams.MatchType,
+			Pattern:   ruleParams.Pattern,
+			Action:    ruleParams.Action,
+			Tag:       ruleParams.Tag,
+		})
+		if err != nil {
+			return err
+		}
+
+		posts, err := ruleCandidates(s, user, ruleParams.FeedID)
+		if err != nil {
+			return err
+		}
+
+		matched := 0
+		out := newListing("id", "title")
+		for _, post := range posts {
+			if !rule.matches(post) {
+				continue
+			}
+			matched++
+			if matched <= *limit {
+				out.add(post.shortID, post.title)
+			}
+		}
+
+		err = out.print(s)
+		if err != nil {
+			return err
+		}
+		if s.format == "table" {
+			fmt.Printf("Rule would %s %d of %d posts\n", rule.Action, matched, len(posts))
+		}
+		return nil
+	case "apply":
+		return applyRules(s, user, args)
+	default:
+		return fmt.Errorf("unknown rule subcommand %s, use add, ls, rm, test or apply", cmd.args[0])
+	}
+}
+
+// applyRules runs saved rules against posts that are already in the
+// database, either one rule by id or all of the user's rules.
+func applyRules(s *state, user database.User, args []string) error {
+	applyFlags := flag.NewFlagSet("rule apply", flag.ContinueOnError)
+	dryRun := applyFlags.Bool("dry-run", false, "count matching posts without changing anything")
+	err := parseFlags(applyFlags, args)
+	if err != nil {
+		return err
+	}
+
+	var rules []compiledRule
+	if applyFlags.NArg() > 0 {
+		shortID, err := strconv.ParseInt(applyFlags.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing rule id %s", applyFlags.Arg(0))
+		}
+		rule, err := s.db.GetRuleByShortID(s.ctx, database.GetRuleByShortIDParams{UserID: user.ID, ShortID: shortID})
+		if err != nil {
+			return fmt.Errorf("rule %d not found", shortID)
+		}
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, compiled)
+	} else {
+		userRules, err := s.db.GetRulesForUser(s.ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("error fetching rules for user %s: %v", user.Name, err)
+		}
+		for _, userRule := range userRules {
+			compiled, err := compileRule(database.Rule{
+				ID:        userRule.ID,
+				ShortID:   userRule.ShortID,
+				CreatedAt: userRule.CreatedAt,
+				UpdatedAt: userRule.UpdatedAt,
+				UserID:    userRule.UserID,
+				FeedID:    userRule.FeedID,
+				Field:     userRule.Field,
+				MatchType: userRule.MatchType,
+				Pattern:   userRule.Pattern,
+				Action:    userRule.Action,
+				Tag:       userRule.Tag,
+			})
+			if err != nil {
+				return err
+			}
+			rules = append(rules, compiled)
+		}
+	}
+
+	if len(rules) == 0 {
+		fmt.Printf("User %s has no rules\n", user.Name)
+		return nil
+	}
+
+	posts, err := ruleCandidates(s, user, uuid.NullUUID{})
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		matched := 0
+		for _, post := range posts {
+			if !rule.matches(post) {
+				continue
+			}
+			matched++
+			if *dryRun {
+				continue
+			}
+			err := rule.apply(s.ctx, s.db, post)
+			if err != nil {
+				return err
+			}
+		}
+
+		if *dryRun {
+			fmt.Printf("Rule %d would %s %d posts\n", rule.ShortID, rule.Action, matched)
+		} else {
+			fmt.Printf("Rule %d: %s applied to %d posts\n", rule.ShortID, rule.Action, matched)
+		}
+	}
+
+	return nil
+}
+
+func handlerUnread(s *state, cmd command, user database.User) error {
+	post, err := getPostArg(s, user, cmd)
+	if err != nil {
+		return err
+	}
+
+	unreadParams := database.MarkPostUnreadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	err = s.db.MarkPostUnread(s.ctx, unreadParams)
+	if err != nil {
+		return fmt.Errorf("error marking post %d unread: %v", post.ShortID, err)
+	}
+
+	fmt.Printf("Marked post %d (%s) as unread\n", post.ShortID, post.Title)
+	return nil
+}
+
+func handlerSearch(s *state, cmd command, user database.User) error {
+	searchFlags := flag.NewFlagSet("search", flag.ContinueOnError)
+	feedName := searchFlags.String("feed", "", "only search posts from this feed (url, name or alias)")
+	since := searchFlags.String("since", "", "only search posts published on or after this date, e.g. 2024-01-31")
+	limit := searchFlags.Int("limit", 20, "number of results to show")
+	query, err := parseSearchArgs(searchFlags, cmd.args)
+	if err != nil {
+		return err
+	}
+
+	searchParams := database.SearchPostsParams{
+		Query:    query,
+		UserID:   user.ID,
+		RowLimit: int32(*limit),
+	}
+
+	if *feedName != "" {
+		feed, err := getUserFeed(s, user, *feedName)
+		if err != nil {
+			return err
+		}
+		searchParams.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	if *since != "" {
+		sinceTime, err := parseDate(*since)
+		if err != nil {
+			return err
+		}
+		searchParams.Since = sql.NullTime{Time: sinceTime, Valid: true}
+	}
+
+	results, err := s.db.SearchPosts(s.ctx, searchParams)
+	if err != nil {
+		return fmt.Errorf("error searching posts: %v", err)
+	}
+
+	out := newListing("id", "feed", "title", "url", "published_at", "rank")
+	out.empty = fmt.Sprintf("No posts matched %q", searchParams.Query)
+	for _, post := range results {
+		out.add(post.ShortID, post.FeedName, post.PostTitle, post.Url, post.PublishedAt, post.Rank)
+	}
+
+	return out.print(s)
+}
+
+// parseSearchArgs parses search's flags and returns the query. Unlike other
+// commands, flags must come before the query: everything from its first word
+// on is the query, so words like -java exclude terms instead of being read
+// as flags.
+func parseSearchArgs(fs *flag.FlagSet, args []string) (string, error) {
+	err := fs.Parse(args)
+	if err != nil {
+		return "", err
+	}
+	if fs.NArg() == 0 {
+		return "", fmt.Errorf("must provide a search query")
+	}
+	return strings.Join(fs.Args(), " "), nil
+}
+
+func handlerServeFeed(s *state, cmd command, user database.User) error {
+	serveFlagSet := flag.NewFlagSet("serve-feed", flag.ContinueOnError)
+	feedFlags := addPublishFlags(serveFlagSet)
+	addr := serveFlagSet.String("addr", "127.0.0.1:8080", "address to listen on")
+	path := serveFlagSet.String("path", "/feed", "url path to serve the feed at")
+	err := parseFlags(serveFlagSet, cmd.args)
+	if err != nil {
+		return err
+	}
+	err = feedFlags.validate()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(*path, "/") {
+		return fmt.Errorf("--path must start with /")
+	}
+
+	return serveFeed(s, user, feedFlags, *addr, *path)
+}
+
+func handlerStar(s *state, cmd command, user database.User) error {
+	post, err := getPostArg(s, user, cmd)
+	if err != nil {
+		return err
+	}
+
+	starParams := database.StarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	err = s.db.StarPost(s.ctx, starParams)
+	if err != nil {
+		return fmt.Errorf("error starring post %d: %v", post.ShortID, err)
+	}
+
+	fmt.Printf("Starred post %d (%s)\n", post.ShortID, post.Title)
+	return nil
+}
+
+func handlerStarred(s *state, cmd command, user database.User) error {
+	starred, err := s.db.GetStarredPosts(s.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching starred posts: %v", err)
+	}
+
+	out := newListing("id", "feed", "title", "url", "starred_at")
+	out.empty = fmt.Sprintf("User %s has no starred posts", user.Name)
+	for _, post := range starred {
+		out.add(post.ShortID, post.FeedName, post.PostTitle, post.Url, post.StarredAt)
+	}
+
+	return out.print(s)
+}
+
+func handlerUnfollow(s *state, cmd command, user database.User) error {
+	if len(cmd.args) == 0 {
+		return fmt.Errorf("no feed url provided to unfollow")
+	}
+
+	feed, err := s.db.GetFeed(s.ctx, cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("error fetching feed: %v", err)
+	}
+
+	unfollowParams := database.DeleteFeedFollowForUserParams{
+		UserID: user.ID,
+		FeedID: feed.ID,
+	}
+
+	err = s.db.DeleteFeedFollowForUser(s.ctx, unfollowParams)
+	if err != nil {
+		return fmt.Errorf("error deleting feed %s for user %s", feed.Name, user.Name)
+	}
+
+	// Start the gc grace period now rather than whenever agg or gc next runs.
+	err = s.db.MarkFeedOrphaned(s.ctx, feed.ID)
+	if err != nil {
+		return fmt.Errorf("error marking feed %s orphaned: %v", feed.Name, err)
+	}
+
+	fmt.Printf("User %s is no longer following feed %s\n", user.Name, feed.Name)
+	return nil
+}
+
+func handlerUnstar(s *state, cmd command, user database.User) error {
+	post, err := getPostArg(s, user, cmd)
+	if err != nil {
+		return err
+	}
+
+	unstarParams := database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	err = s.db.UnstarPost(s.ctx, unstarParams)
+	if err != nil {
+		return fmt.Errorf("error unstarring post %d: %v", post.ShortID, err)
+	}
+
+	fmt.Printf("Unstarred post %d (%s)\n", post.ShortID, post.Title)
+	return nil
+}
+
+func handlerUsers(s *state, cmd command) error {
+	currentUser := s.config.CurrentUserName
+
+	users, err := s.db.GetUsers(s.ctx)
+	if err != nil {
+		return fmt.Errorf("error fetching users: %v", err)
+	}
+
+	if len(users) == 0 {
+		return fmt.Errorf("no users to list")
+	}
+
+	out := newListing("name", "current")
+	for _, user := range users {
+		out.add(user, user == currentUser)
+	}
+
+	return out.print(s)
+}
+
+func handlerView(s *state, cmd command, user database.User) error {
+	post, err := getPostArg(s, user, cmd)
+	if err != nil {
+		return err
+	}
+
+	width := 80
+	if cols, _, ok := terminalSize(); ok {
+		width = cols
+	} else if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		width = cols
+	}
+
+	fmt.Println(colorize(colorEnabled(), ansiColors["bold"], terminalSafe(post.Title)))
+	fmt.Println(terminalSafe(post.Url))
+	publishedAt := post.CreatedAt
+	if post.PublishedAt.Valid {
+		publishedAt = post.PublishedAt.Time
+	}
+	byline := publishedAt.Local().Format("2006-01-02 15:04")
+	if post.Author.Valid && post.Author.String != "" {
+		byline = terminalSafe(post.Author.String) + " · " + byline
+	}
+	fmt.Println(byline)
+
+	body := htmltext.Render(post.Description.String, htmltext.Options{
+		Width:      width,
+		Hyperlinks: hyperlinksSupported(),
+	})
+	if body != "" {
+		fmt.Printf("\n%s\n", body)
+	}
+
+	readParams := database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+
+	err = s.db.MarkPostRead(s.ctx, readParams)
+	if err != nil {
+		return fmt.Errorf("error marking post %d read: %v", post.ShortID, err)
+	}
+
+	return nil
+}
+
+// getPostArg looks up the post whose short ID (as shown by browse) is the
+// command's first argument, among the posts of feeds user follows.
+func getPostArg(s *state, user database.User, cmd command) (database.Post, error) {
+	if len(cmd.args) == 0 {
+		return database.Post{}, fmt.Errorf("must provide a post id")
+	}
+
+	shortID, err := strconv.ParseInt(cmd.args[0], 10, 64)
+	if err != nil {
+		return database.Post{}, fmt.Errorf("error parsing post id %s", cmd.args[0])
+	}
+
+	post, err := s.db.GetPostByShortID(s.ctx, database.GetPostByShortIDParams{
+		ShortID: shortID,
+		UserID:  user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Post{}, fmt.Errorf("post %d not found", shortID)
+	}
+	if err != nil {
+		return database.Post{}, fmt.Errorf("error fetching post %d: %v", shortID, err)
+	}
+
+	return post, nil
+}
+
+// getUserFeed looks up a feed by the alias user gave it, its url or its
+// name, preferring the user's own follows.
+func getUserFeed(s *state, user database.User, feedArg string) (database.Feed, error) {
+	feed, err := s.db.GetFeedForUser(s.ctx, database.GetFeedForUserParams{
+		UserID: user.ID,
+		Feed:   feedArg,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Feed{}, fmt.Errorf("feed %s not found", feedArg)
+	}
+	if err != nil {
+		return database.Feed{}, fmt.Errorf("error fetching feed %s: %v", feedArg, err)
+	}
+	return feed, nil
+}
+
+// parseShortIDArg parses the numeric id that subcommands like rule rm take as
+// their first argument.
+func parseShortIDArg(args []string, what string) (int64, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("must provide a %s id", what)
+	}
+
+	shortID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s id %s", what, args[0])
+	}
+	return shortID, nil
+}
+
+// parseFlags parses args with fs, accepting flags after positional
+// arguments too, so "rule apply 3 --dry-run" is a dry run rather than a real
+// one. A "--" still ends flag parsing.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return err
+		}
+		rest := fs.Args()
+		consumed := len(args) - len(rest)
+		if len(rest) == 0 || (consumed > 0 && args[consumed-1] == "--") {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// dateFormats are the layouts accepted for date arguments.
+var dateFormats = []string{time.DateOnly, time.DateTime, time.RFC3339}
+
+func parseDate(date string) (time.Time, error) {
+	for _, dateFormat := range dateFormats {
+		parsed, err := time.ParseInLocation(dateFormat, date, time.Local)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("error parsing date %s - use a format like 2024-01-31 or 2024-01-31 15:04:05", date)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantDry  bool
+		wantFeed string
+		wantArgs []string
+		wantErr  bool
+	}{
+		{"flags first", []string{"--dry-run", "3"}, true, "", []string{"3"}, false},
+		{"flags after positional", []string{"3", "--dry-run"}, true, "", []string{"3"}, false},
+		{"flags between positionals", []string{"apply", "--feed", "go", "3"}, false, "go", []string{"apply", "3"}, false},
+		{"no flags", []string{"a", "b"}, false, "", []string{"a", "b"}, false},
+		{"double dash ends flags", []string{"3", "--", "--dry-run"}, false, "", []string{"3", "--dry-run"}, false},
+		{"stdin dash is positional", []string{"-", "--dry-run"}, true, "", []string{"-"}, false},
+		{"unknown flag after positional", []string{"3", "--dryrun"}, false, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			dryRun := fs.Bool("dry-run", false, "")
+			feed := fs.String("feed", "", "")
+
+			err := parseFlags(fs, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFlags(%q) error = %v, want error %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *dryRun != tt.wantDry || *feed != tt.wantFeed || !slices.Equal(fs.Args(), tt.wantArgs) {
+				t.Errorf("parseFlags(%q) = dry-run %v, feed %q, args %q; want %v, %q, %q",
+					tt.args, *dryRun, *feed, fs.Args(), tt.wantDry, tt.wantFeed, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseSearchArgs(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantQuery string
+		wantFeed  string
+		wantErr   bool
+	}{
+		{[]string{"go", "-java"}, "go -java", "", false},
+		{[]string{"postgres", "-mysql", "or", "sqlite"}, "postgres -mysql or sqlite", "", false},
+		{[]string{"--feed", "blog", "go", "-java"}, "go -java", "blog", false},
+		{[]string{"go", "--feed", "blog"}, "go --feed blog", "", false},
+		{[]string{"--feed", "blog"}, "", "blog", true},
+		{[]string{"--nope", "go"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("search", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		feed := fs.String("feed", "", "")
+
+		query, err := parseSearchArgs(fs, tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSearchArgs(%q) error = %v, want error %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (query != tt.wantQuery || *feed != tt.wantFeed) {
+			t.Errorf("parseSearchArgs(%q) = query %q, feed %q; want %q, %q", tt.args, query, *feed, tt.wantQuery, tt.wantFeed)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/d-shames3/gator/internal/config"
+	"github.com/d-shames3/gator/internal/database"
+)
+
+// digestFrequencies maps each supported digest schedule to how far apart
+// digests are sent.
+var digestFrequencies = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+// maxDigestPosts caps how many posts a single digest lists.
+const maxDigestPosts = 500
+
+type digest struct {
+	User  string
+	Since time.Time
+	Until time.Time
+	Count int
+	// Truncated is set when there were more than maxDigestPosts new posts
+	// and only the first ones are listed.
+	Truncated bool
+	Feeds     []digestFeed
+}
+
+type digestFeed struct {
+	Name  string
+	Posts []database.GetDigestPostsRow
+}
+
+var digestText = texttemplate.Must(texttemplate.New("digest").Parse(`Hi {{.User}},
+
+{{if .Truncated}}More than {{.Count}} new posts since {{.Since.Format "Mon Jan 2 15:04"}}. Only the first {{.Count}} are listed here; run "gator browse --sort fetched" to see the rest.{{else}}{{.Count}} new posts since {{.Since.Format "Mon Jan 2 15:04"}}.{{end}}
+{{range .Feeds}}
+{{.Name}}
+{{range .Posts}}  * {{.PostTitle}}
+    {{.Url}}
+{{end}}{{end}}
+--
+Sent by gator. Run "gator digest unsubscribe" to stop these emails.
+`))
+
+var digestHTML = htmltemplate.Must(htmltemplate.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>Hi {{.User}},</p>
+{{if .Truncated}}<p>More than {{.Count}} new posts since {{.Since.Format "Mon Jan 2 15:04"}}. Only the first {{.Count}} are listed here; run <code>gator browse --sort fetched</code> to see the rest.</p>{{else}}<p>{{.Count}} new posts since {{.Since.Format "Mon Jan 2 15:04"}}.</p>{{end}}
+{{range .Feeds}}<h3>{{.Name}}</h3>
+<ul>
+{{range .Posts}}<li><a href="{{.Url}}">{{.PostTitle}}</a></li>
+{{end}}</ul>
+{{end}}<p style="color: #888;">Sent by gator. Run <code>gator digest unsubscribe</code> to stop these emails.</p>
+</body>
+</html>
+`))
+
+// buildDigest collects the posts user's followed feeds gained between their
+// last digest and until, grouped by feed. A first digest covers one period.
+func buildDigest(s *state, user database.User, until time.Time) (digest, error) {
+	since := until.Add(-digestFrequencies[user.DigestFrequency.String])
+	if user.LastDigestAt.Valid {
+		since = user.LastDigestAt.Time
+	}
+
+	posts, err := s.db.GetDigestPosts(s.ctx, database.GetDigestPostsParams{
+		UserID:   user.ID,
+		Since:    since,
+		Until:    until,
+		RowLimit: maxDigestPosts + 1,
+	})
+	if err != nil {
+		return digest{}, fmt.Errorf("error fetching digest posts for %s: %v", user.Name, err)
+	}
+
+	d := digest{User: user.Name, Since: since, Until: until}
+	if len(posts) > maxDigestPosts {
+		posts = posts[:maxDigestPosts]
+		d.Truncated = true
+	}
+	d.Count = len(posts)
+	for _, post := range posts {
+		if len(d.Feeds) == 0 || d.Feeds[len(d.Feeds)-1].Name != post.FeedName {
+			d.Feeds = append(d.Feeds, digestFeed{Name: post.FeedName})
+		}
+		feed := &d.Feeds[len(d.Feeds)-1]
+		feed.Posts = append(feed.Posts, post)
+	}
+	return d, nil
+}
+
+// renderDigestEmail builds a multipart/alternative message with plain-text
+// and HTML versions of the digest.
+func renderDigestEmail(from, to string, d digest) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		render      func(*bytes.Buffer) error
+	}{
+		{"text/plain; charset=utf-8", func(b *bytes.Buffer) error { return digestText.Execute(b, d) }},
+		{"text/html; charset=utf-8", func(b *bytes.Buffer) error { return digestHTML.Execute(b, d) }},
+	}
+	for _, part := range parts {
+		var rendered bytes.Buffer
+		err := part.render(&rendered)
+		if err != nil {
+			return nil, fmt.Errorf("error rendering digest: %v", err)
+		}
+
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write(rendered.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	subject := fmt.Sprintf("Your gator digest: %d new posts", d.Count)
+	if d.Truncated {
+		subject = fmt.Sprintf("Your gator digest: over %d new posts", d.Count)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", d.Until.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendMail delivers msg through the configured SMTP server. Port 465 uses
+// implicit TLS; any other port upgrades with STARTTLS when the server offers
+// it.
+func sendMail(cfg *config.SMTPConfig, to string, msg []byte) error {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	if cfg.Port != 465 {
+		return smtp.SendMail(cfg.Addr(), auth, cfg.From, []string{to}, msg)
+	}
+
+	conn, err := tls.Dial("tcp", cfg.Addr(), &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		err = client.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(cfg.From)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// sendDigest builds and sends one user's digest, then records it as sent.
+// Digests with no new posts are skipped but still move the window forward.
+// With dryRun the email is printed instead and nothing is recorded.
+func sendDigest(s *state, user database.User, dryRun bool) error {
+	now := time.Now()
+	d, err := buildDigest(s, user, now)
+	if err != nil {
+		return err
+	}
+
+	from := "gator@localhost"
+	if s.config.SMTP != nil && s.config.SMTP.From != "" {
+		from = s.config.SMTP.From
+	}
+
+	if d.Count > 0 {
+		msg, err := renderDigestEmail(from, user.Email.String, d)
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			fmt.Println(strings.ReplaceAll(string(msg), "\r\n", "\n"))
+			return nil
+		}
+
+		if s.config.SMTP == nil || s.config.SMTP.Host == "" {
+			return fmt.Errorf("no smtp server configured, add one to the smtp section of your config file")
+		}
+		err = sendMail(s.config.SMTP, user.Email.String, msg)
+		if err != nil {
+			return fmt.Errorf("error sending digest to %s: %v", user.Email.String, err)
+		}
+		fmt.Printf("Sent digest of %d posts to %s\n", d.Count, user.Email.String)
+	} else {
+		fmt.Printf("No new posts for %s since %v, skipping digest\n", user.Name, d.Since.Format(time.DateTime))
+		if dryRun {
+			return nil
+		}
+	}
+
+	err = s.db.MarkDigestSent(s.ctx, database.MarkDigestSentParams{
+		ID:           user.ID,
+		LastDigestAt: sql.NullTime{Time: now, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error recording digest for %s: %v", user.Name, err)
+	}
+	return nil
+}
+
+// digestDue reports whether user's digest is due, using the same query
+// sendDueDigests does.
+func digestDue(s *state, user database.User) (bool, error) {
+	users, err := s.db.GetDueDigestUsers(s.ctx, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("error checking whether %s is due a digest: %v", user.Name, err)
+	}
+	return slices.ContainsFunc(users, func(due database.User) bool {
+		return due.ID == user.ID
+	}), nil
+}
+
+// sendDueDigests sends a digest to every user whose daily or weekly digest is
+// due. A failure for one user doesn't stop the others; all failures are
+// returned together once everyone has been tried.
+func sendDueDigests(s *state) error {
+	users, err := s.db.GetDueDigestUsers(s.ctx, time.Now())
+	if err != nil {
+		return fmt.Errorf("error fetching users due a digest: %v", err)
+	}
+
+	var errs []error
+	for _, user := range users {
+		err := sendDigest(s, user, false)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
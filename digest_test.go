@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderDigestEmailTruncated(t *testing.T) {
+	d := digest{
+		User:  "ann",
+		Since: time.Date(2024, 1, 30, 8, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC),
+		Count: maxDigestPosts,
+	}
+
+	tests := []struct {
+		truncated   bool
+		wantNotices int
+	}{
+		{false, 0},
+		{true, 2},
+	}
+
+	for _, tt := range tests {
+		d.Truncated = tt.truncated
+		msg, err := renderDigestEmail("gator@example.com", "ann@example.com", d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(msg))))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Both the text and the HTML part say that posts were left out.
+		got := strings.Count(string(decoded), "Only the first 500 are listed here")
+		if got != tt.wantNotices {
+			t.Errorf("truncated %v: notice appears %d times, want %d:\n%s", tt.truncated, got, tt.wantNotices, decoded)
+		}
+	}
+}
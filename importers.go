@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/d-shames3/gator/internal/htmltext"
+	"github.com/google/uuid"
+)
+
+// importedPost is a post from an export along with the user's state for
+// it. The state times are zero when unset, e.g. readAt for unread posts.
+type importedPost struct {
+	feedURL      string
+	url          string
+	title        string
+	description  string
+	author       string
+	commentsURL  string
+	categories   []string
+	publishedAt  time.Time
+	readAt       time.Time
+	starredAt    time.Time
+	queuedAt     time.Time
+	snoozedUntil time.Time
+	hiddenAt     time.Time
+	tags         []string
+}
+
+func (p importedPost) hasState() bool {
+	return !p.readAt.IsZero() || !p.starredAt.IsZero() || !p.queuedAt.IsZero() || !p.hiddenAt.IsZero()
+}
+
+// subscriptionFeedIDs maps the url of each feed an import resolved to its id.
+func subscriptionFeedIDs(changes []subscriptionChange) map[string]uuid.UUID {
+	feedIDs := make(map[string]uuid.UUID, len(changes))
+	for _, change := range changes {
+		if change.action != "invalid" {
+			feedIDs[change.url] = change.feedID
+		}
+	}
+	return feedIDs
+}
+
+// importPosts saves posts into the feeds in feedIDs, skipping ones gator
+// already has and ones whose feed isn't there, and then records the user's
+// state and tags for them. It returns how many posts were new and how many
+// had state recorded.
+func importPosts(s *state, db *database.Queries, user database.User, feedIDs map[string]uuid.UUID, posts []importedPost) (int, int, error) {
+	if len(posts) == 0 {
+		return 0, 0, nil
+	}
+
+	byFeed := make(map[string][]importedPost)
+	var feedOrder []string
+	for _, post := range posts {
+		if _, ok := feedIDs[post.feedURL]; !ok {
+			continue
+		}
+		if byFeed[post.feedURL] == nil {
+			feedOrder = append(feedOrder, post.feedURL)
+		}
+		byFeed[post.feedURL] = append(byFeed[post.feedURL], post)
+	}
+
+	// Imported posts are history, not news: they are saved as if fetched
+	// when they were published, so digests, which select posts by when
+	// they were fetched, don't list them all as new. Undated posts take
+	// the oldest date in the import, and none are dated in the future.
+	now := time.Now()
+	oldest := now
+	for _, post := range posts {
+		if !post.publishedAt.IsZero() && post.publishedAt.Before(oldest) {
+			oldest = post.publishedAt
+		}
+	}
+
+	created := 0
+	urls := make([]string, 0, len(posts))
+	for _, feedURL := range feedOrder {
+		feedPosts := byFeed[feedURL]
+		params := database.CreatePostsParams{
+			FeedID:       feedIDs[feedURL],
+			Ids:          make([]uuid.UUID, 0, len(feedPosts)),
+			CreatedAts:   make([]string, 0, len(feedPosts)),
+			Titles:       make([]string, 0, len(feedPosts)),
+			Urls:         make([]string, 0, len(feedPosts)),
+			Descriptions: make([]string, 0, len(feedPosts)),
+			PublishedAts: make([]string, 0, len(feedPosts)),
+			CommentsUrls: make([]string, 0, len(feedPosts)),
+			Authors:      make([]string, 0, len(feedPosts)),
+			Categories:   make([]string, 0, len(feedPosts)),
+		}
+		for _, post := range feedPosts {
+			publishedAt := ""
+			createdAt := oldest
+			if !post.publishedAt.IsZero() {
+				publishedAt = post.publishedAt.Format(time.RFC3339Nano)
+				createdAt = post.publishedAt
+			}
+			if createdAt.After(now) {
+				createdAt = now
+			}
+			params.Ids = append(params.Ids, uuid.New())
+			// Fetched posts are saved with the local time, so imported
+			// ones are too.
+			params.CreatedAts = append(params.CreatedAts, createdAt.Local().Format(time.RFC3339Nano))
+			params.Titles = append(params.Titles, post.title)
+			params.Urls = append(params.Urls, post.url)
+			params.Descriptions = append(params.Descriptions, htmltext.Sanitize(post.description))
+			params.PublishedAts = append(params.PublishedAts, publishedAt)
+			params.CommentsUrls = append(params.CommentsUrls, post.commentsURL)
+			params.Authors = append(params.Authors, htmltext.CleanText(post.author))
+			params.Categories = append(params.Categories, joinCategories(post.categories))
+			urls = append(urls, post.url)
+		}
+
+		saved, err := db.CreatePosts(s.ctx, params)
+		if err != nil {
+			return 0, 0, fmt.Errorf("error saving posts for %s: %v", feedURL, err)
+		}
+		created += len(saved)
+	}
+
+	// Post urls are unique across feeds, so a url can already be saved
+	// under some other feed. State only goes on posts in the feed the
+	// export put them in.
+	ids := make([]uuid.UUID, 0, len(feedIDs))
+	for _, feedID := range feedIDs {
+		ids = append(ids, feedID)
+	}
+	rows, err := db.GetPostIDsByURL(s.ctx, database.GetPostIDsByURLParams{
+		Urls:    urls,
+		FeedIds: ids,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error looking up imported posts: %v", err)
+	}
+	type feedPost struct {
+		feedID uuid.UUID
+		url    string
+	}
+	postIDs := make(map[feedPost]uuid.UUID, len(rows))
+	for _, row := range rows {
+		postIDs[feedPost{row.FeedID, row.Url}] = row.ID
+	}
+
+	states := 0
+	for _, post := range posts {
+		postID, ok := postIDs[feedPost{feedIDs[post.feedURL], post.url}]
+		if !ok {
+			continue
+		}
+
+		for _, tag := range post.tags {
+			err := db.TagPost(s.ctx, database.TagPostParams{
+				UserID: user.ID,
+				PostID: postID,
+				Tag:    tag,
+			})
+			if err != nil {
+				return 0, 0, fmt.Errorf("error tagging post %s: %v", post.url, err)
+			}
+		}
+
+		if !post.hasState() {
+			continue
+		}
+		err := db.ImportPostState(s.ctx, database.ImportPostStateParams{
+			UserID:       user.ID,
+			PostID:       postID,
+			ReadAt:       nullTime(post.readAt),
+			StarredAt:    nullTime(post.starredAt),
+			QueuedAt:     nullTime(post.queuedAt),
+			SnoozedUntil: nullTime(post.snoozedUntil),
+			HiddenAt:     nullTime(post.hiddenAt),
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("error saving state for post %s: %v", post.url, err)
+		}
+		states++
+	}
+	return created, states, nil
+}
+
+// nullTime is NULL for the zero time.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// uniquePosts drops posts without a url and all but the first post with each
+// url, since urls identify posts in gator.
+func uniquePosts(posts []importedPost) []importedPost {
+	seen := make(map[string]bool, len(posts))
+	unique := posts[:0]
+	for _, post := range posts {
+		if post.url == "" || seen[post.url] {
+			continue
+		}
+		seen[post.url] = true
+		unique = append(unique, post)
+	}
+	return unique
+}
+
+// importHistory parses each file with parse and imports the feeds and posts
+// they contain.
+func importHistory(s *state, user database.User, name string, args []string, parse func([]byte) ([]subscription, []importedPost, error)) error {
+	importFlags := flag.NewFlagSet("import "+name, flag.ContinueOnError)
+	dryRun := importFlags.Bool("dry-run", false, "show what would change without changing anything")
+	err := parseFlags(importFlags, args)
+	if err != nil {
+		return err
+	}
+	if importFlags.NArg() == 0 {
+		return fmt.Errorf("usage: import %s [--dry-run] <file>...", name)
+	}
+
+	var subs []subscription
+	var posts []importedPost
+	for _, file := range importFlags.Args() {
+		data, err := readImportFile(file)
+		if err != nil {
+			return err
+		}
+		fileSubs, filePosts, err := parse(data)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", file, err)
+		}
+		subs = append(subs, fileSubs...)
+		posts = append(posts, filePosts...)
+	}
+
+	return importSubscriptions(s, user, subs, uniquePosts(posts), *dryRun)
+}
+
+// Google Reader's JSON format, which FreshRSS and Inoreader still use for
+// their exports. Subscription lists have subscriptions, and starred or
+// other item exports have items.
+type greaderExport struct {
+	Subscriptions []greaderSubscription `json:"subscriptions"`
+	Items         []greaderItem         `json:"items"`
+}
+
+type greaderSubscription struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	URL        string            `json:"url"`
+	Categories []greaderCategory `json:"categories"`
+}
+
+type greaderCategory struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type greaderItem struct {
+	Title         string        `json:"title"`
+	Published     int64         `json:"published"`
+	TimestampUsec string        `json:"timestampUsec"`
+	Canonical     []greaderLink `json:"canonical"`
+	Alternate     []greaderLink `json:"alternate"`
+	Summary       struct {
+		Content string `json:"content"`
+	} `json:"summary"`
+	Content struct {
+		Content string `json:"content"`
+	} `json:"content"`
+	Author     string   `json:"author"`
+	Categories []string `json:"categories"`
+	Origin     struct {
+		StreamID string `json:"streamId"`
+		Title    string `json:"title"`
+	} `json:"origin"`
+}
+
+type greaderLink struct {
+	Href string `json:"href"`
+}
+
+func parseGReader(data []byte) ([]subscription, []importedPost, error) {
+	var export greaderExport
+	err := json.Unmarshal(data, &export)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var subs []subscription
+	for _, sub := range export.Subscriptions {
+		feedURL := sub.URL
+		if feedURL == "" {
+			feedURL = strings.TrimPrefix(sub.ID, "feed/")
+		}
+		folder := ""
+		if len(sub.Categories) > 0 {
+			folder = sub.Categories[0].Label
+		}
+		subs = append(subs, subscription{
+			url:    feedURL,
+			title:  htmltext.CleanText(html.UnescapeString(sub.Title)),
+			folder: htmltext.CleanText(folder),
+		})
+	}
+
+	now := time.Now()
+	var posts []importedPost
+	for _, item := range export.Items {
+		feedURL, ok := strings.CutPrefix(item.Origin.StreamID, "feed/")
+		if !ok {
+			continue
+		}
+		subs = append(subs, subscription{
+			url:   feedURL,
+			title: htmltext.CleanText(html.UnescapeString(item.Origin.Title)),
+		})
+
+		post := importedPost{
+			feedURL:     feedURL,
+			title:       htmltext.CleanText(html.UnescapeString(item.Title)),
+			description: item.Content.Content,
+			author:      item.Author,
+		}
+		if post.description == "" {
+			post.description = item.Summary.Content
+		}
+		for _, links := range [][]greaderLink{item.Canonical, item.Alternate} {
+			if len(links) > 0 && post.url == "" {
+				post.url = links[0].Href
+			}
+		}
+		if item.Published > 0 {
+			post.publishedAt = time.Unix(item.Published, 0)
+		}
+
+		for _, category := range item.Categories {
+			switch {
+			case strings.HasSuffix(category, "/state/com.google/read"):
+				post.readAt = now
+			case strings.HasSuffix(category, "/state/com.google/starred"):
+				// timestampUsec is when the item entered the stream
+				// being exported, which for starred items is when it
+				// was starred.
+				post.starredAt = now
+				if usec, err := strconv.ParseInt(item.TimestampUsec, 10, 64); err == nil && usec > 0 {
+					post.starredAt = time.UnixMicro(usec)
+				}
+			case strings.Contains(category, "/label/"):
+				label := category[strings.Index(category, "/label/")+len("/label/"):]
+				post.categories = append(post.categories, label)
+			}
+		}
+		posts = append(posts, post)
+	}
+	return subs, posts, nil
+}
+
+// Miniflux has no JSON export of its own, so this reads what its API
+// returns: an entries listing from /v1/entries, or a feed list from
+// /v1/feeds.
+type minifluxEntries struct {
+	Entries []minifluxEntry `json:"entries"`
+}
+
+type minifluxEntry struct {
+	Status      string       `json:"status"`
+	Title       string       `json:"title"`
+	URL         string       `json:"url"`
+	PublishedAt time.Time    `json:"published_at"`
+	ChangedAt   time.Time    `json:"changed_at"`
+	Content     string       `json:"content"`
+	Author      string       `json:"author"`
+	Starred     bool         `json:"starred"`
+	Tags        []string     `json:"tags"`
+	Feed        minifluxFeed `json:"feed"`
+}
+
+type minifluxFeed struct {
+	FeedURL  string `json:"feed_url"`
+	Title    string `json:"title"`
+	Category struct {
+		Title string `json:"title"`
+	} `json:"category"`
+}
+
+// minifluxSubscription turns a Miniflux feed into a subscription. Miniflux
+// puts every feed in a category, "All" by default, which isn't worth a
+// folder.
+func minifluxSubscription(feed minifluxFeed) subscription {
+	folder := htmltext.CleanText(feed.Category.Title)
+	if folder == "All" {
+		folder = ""
+	}
+	return subscription{
+		url:    feed.FeedURL,
+		title:  htmltext.CleanText(feed.Title),
+		folder: folder,
+	}
+}
+
+func parseMiniflux(data []byte) ([]subscription, []importedPost, error) {
+	var subs []subscription
+	if trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace); len(trimmed) > 0 && trimmed[0] == '[' {
+		var feeds []minifluxFeed
+		err := json.Unmarshal(data, &feeds)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, feed := range feeds {
+			subs = append(subs, minifluxSubscription(feed))
+		}
+		return subs, nil, nil
+	}
+
+	var export minifluxEntries
+	err := json.Unmarshal(data, &export)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	var posts []importedPost
+	for _, entry := range export.Entries {
+		subs = append(subs, minifluxSubscription(entry.Feed))
+		post := importedPost{
+			feedURL:     entry.Feed.FeedURL,
+			url:         entry.URL,
+			title:       htmltext.CleanText(entry.Title),
+			description: entry.Content,
+			author:      entry.Author,
+			categories:  entry.Tags,
+			publishedAt: entry.PublishedAt,
+		}
+		// Removed entries were read before they were removed.
+		if entry.Status == "read" || entry.Status == "removed" {
+			post.readAt = entry.ChangedAt
+			if post.readAt.IsZero() {
+				post.readAt = now
+			}
+		}
+		if entry.Starred {
+			post.starredAt = now
+		}
+		posts = append(posts, post)
+	}
+	return subs, posts, nil
+}
+
+// parseNewsboatURLs reads a Newsboat urls file: one feed per line, followed
+// by its tags. A tag starting with ~ renames the feed, tags starting with !
+// hide it and are ignored, and the first other tag becomes its folder. Query
+// feeds are skipped since they only collect posts from other feeds.
+func parseNewsboatURLs(data []byte) []subscription {
+	var subs []subscription
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := newsboatFields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "query:") {
+			continue
+		}
+
+		sub := subscription{url: fields[0]}
+		for _, tag := range fields[1:] {
+			switch {
+			case strings.HasPrefix(tag, "~"):
+				sub.title = htmltext.CleanText(tag[1:])
+			case strings.HasPrefix(tag, "!"):
+			case sub.folder == "":
+				sub.folder = htmltext.CleanText(tag)
+			}
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// newsboatFields splits a urls file line on whitespace, keeping double
+// quoted strings together and stopping at a # comment.
+func newsboatFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	inField, quoted := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case quoted:
+			field.WriteRune(r)
+		case r == '#' && !inField:
+			return fields
+		case unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+type newsboatFeed struct {
+	RSSURL string `json:"rssurl"`
+	Title  string `json:"title"`
+}
+
+type newsboatItem struct {
+	FeedURL string `json:"feedurl"`
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Author  string `json:"author"`
+	PubDate int64  `json:"pubDate"`
+	Content string `json:"content"`
+	Unread  int    `json:"unread"`
+}
+
+// readNewsboatCache reads the feeds and posts in a Newsboat cache.db using
+// the sqlite3 command line tool, which saves gator a sqlite driver. Newsboat
+// has no stars, so only read state comes across.
+func readNewsboatCache(path string) (map[string]string, []importedPost, error) {
+	var feeds []newsboatFeed
+	err := sqliteJSON(path, "SELECT rssurl, title FROM rss_feed", &feeds)
+	if err != nil {
+		return nil, nil, err
+	}
+	titles := make(map[string]string, len(feeds))
+	for _, feed := range feeds {
+		titles[feed.RSSURL] = htmltext.CleanText(feed.Title)
+	}
+
+	var items []newsboatItem
+	err = sqliteJSON(path, "SELECT feedurl, url, title, author, pubDate, content, unread FROM rss_item WHERE deleted = 0", &items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	posts := make([]importedPost, 0, len(items))
+	for _, item := range items {
+		post := importedPost{
+			feedURL:     item.FeedURL,
+			url:         item.URL,
+			title:       htmltext.CleanText(item.Title),
+			description: item.Content,
+			author:      item.Author,
+		}
+		if item.PubDate > 0 {
+			post.publishedAt = time.Unix(item.PubDate, 0)
+		}
+		if item.Unread == 0 {
+			post.readAt = now
+		}
+		posts = append(posts, post)
+	}
+	return titles, posts, nil
+}
+
+// sqliteJSON runs query against the sqlite database at path and decodes the
+// rows into dest.
+func sqliteJSON(path, query string, dest any) error {
+	cmd := exec.Command("sqlite3", "-readonly", "-json", path, query)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("error reading %s with sqlite3: %v: %s", path, err, msg)
+		}
+		return fmt.Errorf("error reading %s with sqlite3: %v", path, err)
+	}
+	// sqlite3 prints nothing at all for an empty result.
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+	err = json.Unmarshal(out, dest)
+	if err != nil {
+		return fmt.Errorf("error decoding sqlite3 output for %s: %v", path, err)
+	}
+	return nil
+}
+
+func importNewsboat(s *state, user database.User, args []string) error {
+	newsboatFlags := flag.NewFlagSet("import newsboat", flag.ContinueOnError)
+	dryRun := newsboatFlags.Bool("dry-run", false, "show what would change without changing anything")
+	cache := newsboatFlags.String("cache", "", "newsboat's cache.db, to bring over posts and read state")
+	err := parseFlags(newsboatFlags, args)
+	if err != nil {
+		return err
+	}
+	if newsboatFlags.NArg() != 1 {
+		return fmt.Errorf("usage: import newsboat [--dry-run] [--cache <cache.db>] <urls file>")
+	}
+
+	data, err := readImportFile(newsboatFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	subs := parseNewsboatURLs(data)
+
+	var posts []importedPost
+	if *cache != "" {
+		titles, cachePosts, err := readNewsboatCache(*cache)
+		if err != nil {
+			return err
+		}
+		for i, sub := range subs {
+			if sub.title == "" {
+				subs[i].title = titles[sub.url]
+			}
+		}
+		posts = uniquePosts(cachePosts)
+	}
+
+	return importSubscriptions(s, user, subs, posts, *dryRun)
+}
@@ -3,16 +3,44 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 )
 
 type Config struct {
-	DbURL           string `json:"db_url"`
-	CurrentUserName string `json:"current_user_name"`
+	DbURL           string      `json:"db_url"`
+	CurrentUserName string      `json:"current_user_name"`
+	MaxFeedBytes    int64       `json:"max_feed_bytes,omitempty"`
+	Browser         string      `json:"browser,omitempty"`
+	SMTP            *SMTPConfig `json:"smtp,omitempty"`
+	// Templates maps a command name, or a command and subcommand like
+	// "rule ls", to the output template (or built-in template name) its
+	// listing uses by default.
+	Templates map[string]string `json:"templates,omitempty"`
+	// NotifyCommands maps a name to a shell command that exec notification
+	// sinks can run. Users pick a command by name, so only commands set up
+	// here by whoever runs agg are ever executed.
+	NotifyCommands map[string]string `json:"notify_commands,omitempty"`
+}
+
+// SMTPConfig is the mail server digests are sent through.
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
 }
 
 const configFileName = ".gatorconfig.json"
 
+const defaultMaxFeedBytes = 10 * 1024 * 1024
+
+const defaultBrowser = "xdg-open"
+
+const defaultSMTPPort = 587
+
 func getConfigFilePath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -50,6 +78,15 @@ func (c *Config) SetUser(userName string) error {
 	return write(c)
 }
 
+// MaxFeedSize returns the largest RSS response body, in bytes, that will be
+// read before a fetch is aborted. Falls back to 10MB when unset.
+func (c *Config) MaxFeedSize() int64 {
+	if c.MaxFeedBytes <= 0 {
+		return defaultMaxFeedBytes
+	}
+	return c.MaxFeedBytes
+}
+
 func Read() (Config, error) {
 	configFilePath, err := getConfigFilePath()
 	var config Config
@@ -70,3 +107,25 @@ func Read() (Config, error) {
 	}
 	return config, nil
 }
+
+// BrowserCommand returns the command used to open links: the browser set in
+// the config file, then $BROWSER, then xdg-open.
+func (c *Config) BrowserCommand() string {
+	if c.Browser != "" {
+		return c.Browser
+	}
+	if browser := os.Getenv("BROWSER"); browser != "" {
+		return browser
+	}
+	return defaultBrowser
+}
+
+// Addr returns the server's host:port, using the submission port 587 when no
+// port is set.
+func (s *SMTPConfig) Addr() string {
+	port := s.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	return net.JoinHostPort(s.Host, strconv.Itoa(port))
+}
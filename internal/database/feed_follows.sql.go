@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,7 +23,7 @@ WITH inserted_feed_follows AS (
         $4,
         $5
     )
-    RETURNING id, created_at, updated_at, user_id, feed_id
+    RETURNING id, created_at, updated_at, user_id, feed_id, folder, alias
 )
 SELECT
     inserted_feed_follows.id,
@@ -97,20 +98,38 @@ const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
 
 SELECT
     feed_follows.id,
+    feed_follows.feed_id,
     users.name as user,
-    feeds.name as feed
+    COALESCE(feed_follows.alias, feeds.name) as feed,
+    feeds.url,
+    feed_follows.folder,
+    (
+        SELECT count(*)
+        FROM posts
+        LEFT JOIN post_states
+            ON posts.id = post_states.post_id
+            AND post_states.user_id = feed_follows.user_id
+        WHERE posts.feed_id = feed_follows.feed_id
+        AND post_states.read_at IS NULL
+        AND post_states.hidden_at IS NULL
+    ) as unread
 FROM feed_follows
 INNER JOIN users
     ON feed_follows.user_id = users.id
 INNER JOIN feeds
     ON feed_follows.feed_id = feeds.id
 WHERE feed_follows.user_id = $1
+ORDER BY feed_follows.folder NULLS LAST, COALESCE(feed_follows.alias, feeds.name)
 `
 
 type GetFeedFollowsForUserRow struct {
-	ID   uuid.UUID
-	User string
-	Feed string
+	ID     uuid.UUID
+	FeedID uuid.UUID
+	User   string
+	Feed   string
+	Url    string
+	Folder sql.NullString
+	Unread int64
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
@@ -122,7 +141,66 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	var items []GetFeedFollowsForUserRow
 	for rows.Next() {
 		var i GetFeedFollowsForUserRow
-		if err := rows.Scan(&i.ID, &i.User, &i.Feed); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.User,
+			&i.Feed,
+			&i.Url,
+			&i.Folder,
+			&i.Unread,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowsForExport = `-- name: GetFollowsForExport :many
+SELECT
+    feeds.url,
+    feeds.name,
+    feed_follows.folder,
+    feed_follows.alias,
+    feed_follows.created_at
+FROM feed_follows
+INNER JOIN feeds
+    ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feed_follows.created_at
+`
+
+type GetFollowsForExportRow struct {
+	Url       string
+	Name      string
+	Folder    sql.NullString
+	Alias     sql.NullString
+	CreatedAt time.Time
+}
+
+func (q *Queries) GetFollowsForExport(ctx context.Context, userID uuid.UUID) ([]GetFollowsForExportRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowsForExport, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFollowsForExportRow
+	for rows.Next() {
+		var i GetFollowsForExportRow
+		if err := rows.Scan(
+			&i.Url,
+			&i.Name,
+			&i.Folder,
+			&i.Alias,
+			&i.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -135,3 +213,43 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	}
 	return items, nil
 }
+
+const setFeedFollowAlias = `-- name: SetFeedFollowAlias :execrows
+UPDATE feed_follows
+SET updated_at = CURRENT_TIMESTAMP, alias = $3
+WHERE user_id = $1 AND feed_id = $2
+`
+
+type SetFeedFollowAliasParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+	Alias  sql.NullString
+}
+
+func (q *Queries) SetFeedFollowAlias(ctx context.Context, arg SetFeedFollowAliasParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setFeedFollowAlias, arg.UserID, arg.FeedID, arg.Alias)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setFeedFollowFolder = `-- name: SetFeedFollowFolder :execrows
+UPDATE feed_follows
+SET updated_at = CURRENT_TIMESTAMP, folder = $3
+WHERE user_id = $1 AND feed_id = $2
+`
+
+type SetFeedFollowFolderParams struct {
+	UserID uuid.UUID
+	FeedID uuid.UUID
+	Folder sql.NullString
+}
+
+func (q *Queries) SetFeedFollowFolder(ctx context.Context, arg SetFeedFollowFolderParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setFeedFollowFolder, arg.UserID, arg.FeedID, arg.Folder)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -7,11 +7,45 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimNextFeedToFetch = `-- name: ClaimNextFeedToFetch :one
+UPDATE feeds
+SET updated_at = CURRENT_TIMESTAMP, last_fetched_at = CURRENT_TIMESTAMP
+WHERE id = (
+    SELECT id
+    FROM feeds
+    WHERE EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.feed_id = feeds.id
+    )
+    ORDER BY last_fetched_at NULLS FIRST
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, orphaned_at
+`
+
+func (q *Queries) ClaimNextFeedToFetch(ctx context.Context) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimNextFeedToFetch)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+	)
+	return i, err
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
 VALUES (
@@ -22,7 +56,7 @@ VALUES (
     $5,
     $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, orphaned_at
 `
 
 type CreateFeedParams struct {
@@ -52,10 +86,77 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.OrphanedAt,
 	)
 	return i, err
 }
 
+const deleteOrphanedFeeds = `-- name: DeleteOrphanedFeeds :many
+DELETE FROM feeds
+WHERE orphaned_at < CURRENT_TIMESTAMP - make_interval(secs => $1::float8)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM posts
+    WHERE posts.feed_id = feeds.id
+)
+RETURNING name, url
+`
+
+type DeleteOrphanedFeedsRow struct {
+	Name string
+	Url  string
+}
+
+func (q *Queries) DeleteOrphanedFeeds(ctx context.Context, graceSeconds float64) ([]DeleteOrphanedFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, deleteOrphanedFeeds, graceSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DeleteOrphanedFeedsRow
+	for rows.Next() {
+		var i DeleteOrphanedFeedsRow
+		if err := rows.Scan(&i.Name, &i.Url); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteOrphanedPosts = `-- name: DeleteOrphanedPosts :execrows
+DELETE FROM posts
+USING feeds
+WHERE posts.feed_id = feeds.id
+AND feeds.orphaned_at < CURRENT_TIMESTAMP - make_interval(secs => $1::float8)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id
+    AND post_states.starred_at IS NOT NULL
+)
+`
+
+func (q *Queries) DeleteOrphanedPosts(ctx context.Context, graceSeconds float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrphanedPosts, graceSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getFeed = `-- name: GetFeed :one
 SELECT id, name FROM feeds
 WHERE url = $1 LIMIT 1
@@ -73,6 +174,63 @@ func (q *Queries) GetFeed(ctx context.Context, url string) (GetFeedRow, error) {
 	return i, err
 }
 
+const getFeedByURLOrName = `-- name: GetFeedByURLOrName :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, orphaned_at FROM feeds
+WHERE url = $1 OR name = $1
+ORDER BY url = $1 DESC
+LIMIT 1
+`
+
+func (q *Queries) GetFeedByURLOrName(ctx context.Context, feed string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByURLOrName, feed)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+	)
+	return i, err
+}
+
+const getFeedForUser = `-- name: GetFeedForUser :one
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.orphaned_at FROM feeds
+LEFT JOIN feed_follows
+    ON feeds.id = feed_follows.feed_id
+    AND feed_follows.user_id = $1
+WHERE feed_follows.alias = $2 OR feeds.url = $2 OR feeds.name = $2
+ORDER BY
+    (feed_follows.alias = $2) IS TRUE DESC,
+    feeds.url = $2 DESC,
+    feed_follows.id IS NOT NULL DESC
+LIMIT 1
+`
+
+type GetFeedForUserParams struct {
+	UserID uuid.UUID
+	Feed   string
+}
+
+func (q *Queries) GetFeedForUser(ctx context.Context, arg GetFeedForUserParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedForUser, arg.UserID, arg.Feed)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+	)
+	return i, err
+}
+
 const getFeeds = `-- name: GetFeeds :many
 SELECT
     users.name as user,
@@ -112,30 +270,105 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]GetFeedsRow, error) {
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT url, id
-FROM feeds
+const getFollowedFeeds = `-- name: GetFollowedFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, orphaned_at FROM feeds
+WHERE EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
 ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1
 `
 
-type GetNextFeedToFetchRow struct {
-	Url string
-	ID  uuid.UUID
+func (q *Queries) GetFollowedFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.OrphanedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (GetNextFeedToFetchRow, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
-	var i GetNextFeedToFetchRow
-	err := row.Scan(&i.Url, &i.ID)
-	return i, err
+const getOrphanedFeeds = `-- name: GetOrphanedFeeds :many
+SELECT
+    name,
+    url,
+    orphaned_at,
+    (
+        SELECT count(*)
+        FROM posts
+        INNER JOIN post_states
+            ON posts.id = post_states.post_id
+        WHERE posts.feed_id = feeds.id
+        AND post_states.starred_at IS NOT NULL
+    ) as starred_posts
+FROM feeds
+WHERE orphaned_at < CURRENT_TIMESTAMP - make_interval(secs => $1::float8)
+ORDER BY orphaned_at
+`
+
+type GetOrphanedFeedsRow struct {
+	Name         string
+	Url          string
+	OrphanedAt   sql.NullTime
+	StarredPosts int64
+}
+
+func (q *Queries) GetOrphanedFeeds(ctx context.Context, graceSeconds float64) ([]GetOrphanedFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getOrphanedFeeds, graceSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOrphanedFeedsRow
+	for rows.Next() {
+		var i GetOrphanedFeedsRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.Url,
+			&i.OrphanedAt,
+			&i.StarredPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const markFeedFetched = `-- name: MarkFeedFetched :one
  UPDATE feeds
  SET updated_at = CURRENT_TIMESTAMP, last_fetched_at = CURRENT_TIMESTAMP
  WHERE id = $1
- RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+ RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, orphaned_at
 `
 
 func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
@@ -149,6 +382,59 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) (Feed, erro
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.OrphanedAt,
 	)
 	return i, err
 }
+
+const markFeedOrphaned = `-- name: MarkFeedOrphaned :exec
+UPDATE feeds
+SET orphaned_at = CURRENT_TIMESTAMP
+WHERE id = $1
+AND orphaned_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+`
+
+func (q *Queries) MarkFeedOrphaned(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markFeedOrphaned, id)
+	return err
+}
+
+const markOrphanedFeeds = `-- name: MarkOrphanedFeeds :execrows
+UPDATE feeds
+SET orphaned_at = CURRENT_TIMESTAMP
+WHERE orphaned_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+`
+
+func (q *Queries) MarkOrphanedFeeds(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markOrphanedFeeds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const unmarkFollowedFeeds = `-- name: UnmarkFollowedFeeds :execrows
+UPDATE feeds
+SET orphaned_at = NULL
+WHERE orphaned_at IS NOT NULL
+AND EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+`
+
+func (q *Queries) UnmarkFollowedFeeds(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, unmarkFollowedFeeds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -19,6 +19,7 @@ type Feed struct {
 	Url           string
 	UserID        uuid.UUID
 	LastFetchedAt sql.NullTime
+	OrphanedAt    sql.NullTime
 }
 
 type FeedFollow struct {
@@ -27,6 +28,40 @@ type FeedFollow struct {
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	FeedID    uuid.UUID
+	Folder    sql.NullString
+	Alias     sql.NullString
+}
+
+type FetchLog struct {
+	ID         uuid.UUID
+	FeedID     uuid.UUID
+	StartedAt  time.Time
+	DurationMs int64
+	HttpStatus sql.NullInt32
+	Bytes      int64
+	ItemsSeen  int32
+	NewPosts   int32
+	Error      sql.NullString
+}
+
+type NotifyLog struct {
+	ID          uuid.UUID
+	SinkID      uuid.UUID
+	PostID      uuid.NullUUID
+	AttemptedAt time.Time
+	Attempts    int32
+	Error       sql.NullString
+}
+
+type NotifySink struct {
+	ID        uuid.UUID
+	ShortID   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Kind      string
+	Target    string
+	Keyword   sql.NullString
 }
 
 type Post struct {
@@ -38,11 +73,52 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt sql.NullTime
 	FeedID      uuid.UUID
+	ShortID     int64
+	Search      interface{}
+	CommentsUrl sql.NullString
+	Author      sql.NullString
+	Categories  []string
 }
 
-type User struct {
+type PostState struct {
+	UserID       uuid.UUID
+	PostID       uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	ReadAt       sql.NullTime
+	StarredAt    sql.NullTime
+	QueuedAt     sql.NullTime
+	SnoozedUntil sql.NullTime
+	HiddenAt     sql.NullTime
+}
+
+type PostTag struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type Rule struct {
 	ID        uuid.UUID
+	ShortID   int64
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Name      string
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Field     string
+	MatchType string
+	Pattern   string
+	Action    string
+	Tag       sql.NullString
+}
+
+type User struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Name            string
+	Email           sql.NullString
+	DigestFrequency sql.NullString
+	LastDigestAt    sql.NullTime
 }
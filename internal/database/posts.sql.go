@@ -11,45 +11,187 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
-) 
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+const createPosts = `-- name: CreatePosts :many
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, comments_url, author, categories)
+SELECT
+    new_posts.id,
+    new_posts.created_at::timestamp,
+    new_posts.created_at::timestamp,
+    new_posts.title,
+    new_posts.url,
+    NULLIF(new_posts.description, ''),
+    NULLIF(new_posts.published_at, '')::timestamp,
+    $1::uuid,
+    NULLIF(new_posts.comments_url, ''),
+    NULLIF(new_posts.author, ''),
+    string_to_array(new_posts.categories, E'\n')
+FROM (
+    SELECT
+        unnest($2::uuid[]) AS id,
+        unnest($3::text[]) AS created_at,
+        unnest($4::text[]) AS title,
+        unnest($5::text[]) AS url,
+        unnest($6::text[]) AS description,
+        unnest($7::text[]) AS published_at,
+        unnest($8::text[]) AS comments_url,
+        unnest($9::text[]) AS author,
+        unnest($10::text[]) AS categories
+) AS new_posts
+ON CONFLICT (url) DO NOTHING
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, short_id, search, comments_url, author, categories
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
+type CreatePostsParams struct {
+	FeedID       uuid.UUID
+	Ids          []uuid.UUID
+	CreatedAts   []string
+	Titles       []string
+	Urls         []string
+	Descriptions []string
+	PublishedAts []string
+	CommentsUrls []string
+	Authors      []string
+	Categories   []string
+}
+
+func (q *Queries) CreatePosts(ctx context.Context, arg CreatePostsParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, createPosts,
+		arg.FeedID,
+		pq.Array(arg.Ids),
+		pq.Array(arg.CreatedAts),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.CommentsUrls),
+		pq.Array(arg.Authors),
+		pq.Array(arg.Categories),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.ShortID,
+			&i.Search,
+			&i.CommentsUrl,
+			&i.Author,
+			pq.Array(&i.Categories),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDigestPosts = `-- name: GetDigestPosts :many
+SELECT
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    posts.title as post_title,
+    posts.url,
+    posts.published_at
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND posts.created_at > $2
+AND posts.created_at <= $3
+AND post_states.hidden_at IS NULL
+ORDER BY feed_name, COALESCE(posts.published_at, posts.created_at) DESC
+LIMIT $4
+`
+
+type GetDigestPostsParams struct {
+	UserID   uuid.UUID
+	Since    time.Time
+	Until    time.Time
+	RowLimit int32
+}
+
+type GetDigestPostsRow struct {
+	ShortID     int64
+	FeedName    string
+	PostTitle   string
 	Url         string
-	Description sql.NullString
 	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
-}
-
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
+}
+
+func (q *Queries) GetDigestPosts(ctx context.Context, arg GetDigestPostsParams) ([]GetDigestPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDigestPosts,
+		arg.UserID,
+		arg.Since,
+		arg.Until,
+		arg.RowLimit,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDigestPostsRow
+	for rows.Next() {
+		var i GetDigestPostsRow
+		if err := rows.Scan(
+			&i.ShortID,
+			&i.FeedName,
+			&i.PostTitle,
+			&i.Url,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostByShortID = `-- name: GetPostByShortID :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.short_id, posts.search, posts.comments_url, posts.author, posts.categories FROM posts
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+WHERE posts.short_id = $1
+AND feed_follows.user_id = $2
+`
+
+type GetPostByShortIDParams struct {
+	ShortID int64
+	UserID  uuid.UUID
+}
+
+func (q *Queries) GetPostByShortID(ctx context.Context, arg GetPostByShortIDParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByShortID, arg.ShortID, arg.UserID)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -60,35 +202,126 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.ShortID,
+		&i.Search,
+		&i.CommentsUrl,
+		&i.Author,
+		pq.Array(&i.Categories),
 	)
 	return i, err
 }
 
+const getPostIDsByURL = `-- name: GetPostIDsByURL :many
+SELECT id, url, feed_id FROM posts
+WHERE url = ANY($1::text[])
+AND feed_id = ANY($2::uuid[])
+`
+
+type GetPostIDsByURLParams struct {
+	Urls    []string
+	FeedIds []uuid.UUID
+}
+
+type GetPostIDsByURLRow struct {
+	ID     uuid.UUID
+	Url    string
+	FeedID uuid.UUID
+}
+
+func (q *Queries) GetPostIDsByURL(ctx context.Context, arg GetPostIDsByURLParams) ([]GetPostIDsByURLRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostIDsByURL, pq.Array(arg.Urls), pq.Array(arg.FeedIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPostIDsByURLRow
+	for rows.Next() {
+		var i GetPostIDsByURLRow
+		if err := rows.Scan(&i.ID, &i.Url, &i.FeedID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
 SELECT 
-    feeds.name as feed_name,
+    posts.id,
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
     posts.url,
     posts.title as post_title,
     posts.description,
     posts.created_at,
     posts.updated_at,
-    posts.published_at
+    posts.published_at,
+    post_states.read_at,
+    post_states.starred_at,
+    ARRAY(
+        SELECT post_tags.tag
+        FROM post_tags
+        WHERE post_tags.post_id = posts.id
+        AND post_tags.user_id = feed_follows.user_id
+        ORDER BY post_tags.tag
+    )::text[] as tags
 FROM posts
 INNER JOIN feeds
     ON posts.feed_id = feeds.id
 INNER JOIN feed_follows
     ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.created_at DESC
-LIMIT $2
+AND post_states.hidden_at IS NULL
+AND (NOT $2::bool OR post_states.read_at IS NULL)
+AND ($3::uuid IS NULL OR posts.feed_id = $3)
+AND ($4::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= $4)
+AND ($5::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < $5)
+AND ($6::text IS NULL OR feed_follows.folder = $6)
+AND (
+    $7::bigint IS NULL
+    OR (
+        CASE WHEN $8::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END,
+        posts.short_id
+    ) < (
+        SELECT
+            CASE WHEN $8::text = 'fetched' THEN cursor_post.created_at ELSE COALESCE(cursor_post.published_at, cursor_post.created_at) END,
+            cursor_post.short_id
+        FROM posts AS cursor_post
+        WHERE cursor_post.short_id = $7
+    )
+)
+ORDER BY
+    CASE WHEN $8::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END DESC,
+    posts.short_id DESC
+OFFSET $9
+LIMIT $10
 `
 
 type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID     uuid.UUID
+	UnreadOnly bool
+	FeedID     uuid.NullUUID
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Folder     sql.NullString
+	AfterID    sql.NullInt64
+	SortBy     string
+	RowOffset  int32
+	RowLimit   int32
 }
 
 type GetPostsForUserRow struct {
+	ID          uuid.UUID
+	ShortID     int64
 	FeedName    string
 	Url         string
 	PostTitle   string
@@ -96,10 +329,24 @@ type GetPostsForUserRow struct {
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	PublishedAt sql.NullTime
+	ReadAt      sql.NullTime
+	StarredAt   sql.NullTime
+	Tags        []string
 }
 
 func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.Folder,
+		arg.AfterID,
+		arg.SortBy,
+		arg.RowOffset,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +355,8 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	for rows.Next() {
 		var i GetPostsForUserRow
 		if err := rows.Scan(
+			&i.ID,
+			&i.ShortID,
 			&i.FeedName,
 			&i.Url,
 			&i.PostTitle,
@@ -115,6 +364,175 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.PublishedAt,
+			&i.ReadAt,
+			&i.StarredAt,
+			pq.Array(&i.Tags),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPublishedPosts = `-- name: GetPublishedPosts :many
+SELECT
+    posts.id,
+    posts.url,
+    posts.title,
+    posts.description,
+    posts.author,
+    posts.categories,
+    posts.published_at,
+    posts.created_at,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    feeds.url as feed_url
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND post_states.hidden_at IS NULL
+AND ($2::text IS NULL OR feed_follows.folder = $2)
+AND ($3::text IS NULL OR posts.search @@ websearch_to_tsquery('english', $3))
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.short_id DESC
+LIMIT $4
+`
+
+type GetPublishedPostsParams struct {
+	UserID   uuid.UUID
+	Folder   sql.NullString
+	Query    sql.NullString
+	RowLimit int32
+}
+
+type GetPublishedPostsRow struct {
+	ID          uuid.UUID
+	Url         string
+	Title       string
+	Description sql.NullString
+	Author      sql.NullString
+	Categories  []string
+	PublishedAt sql.NullTime
+	CreatedAt   time.Time
+	FeedName    string
+	FeedUrl     string
+}
+
+func (q *Queries) GetPublishedPosts(ctx context.Context, arg GetPublishedPostsParams) ([]GetPublishedPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPublishedPosts,
+		arg.UserID,
+		arg.Folder,
+		arg.Query,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetPublishedPostsRow
+	for rows.Next() {
+		var i GetPublishedPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Description,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.PublishedAt,
+			&i.CreatedAt,
+			&i.FeedName,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    posts.title as post_title,
+    posts.url,
+    posts.published_at,
+    ts_rank(posts.search, search_query) as rank
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+CROSS JOIN websearch_to_tsquery('english', $1) AS search_query
+WHERE feed_follows.user_id = $2
+AND posts.search @@ search_query
+AND post_states.hidden_at IS NULL
+AND ($3::uuid IS NULL OR posts.feed_id = $3)
+AND ($4::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= $4)
+ORDER BY rank DESC, COALESCE(posts.published_at, posts.created_at) DESC
+LIMIT $5
+`
+
+type SearchPostsParams struct {
+	Query    string
+	UserID   uuid.UUID
+	FeedID   uuid.NullUUID
+	Since    sql.NullTime
+	RowLimit int32
+}
+
+type SearchPostsRow struct {
+	ShortID     int64
+	FeedName    string
+	PostTitle   string
+	Url         string
+	PublishedAt sql.NullTime
+	Rank        float32
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.Query,
+		arg.UserID,
+		arg.FeedID,
+		arg.Since,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsRow
+	for rows.Next() {
+		var i SearchPostsRow
+		if err := rows.Scan(
+			&i.ShortID,
+			&i.FeedName,
+			&i.PostTitle,
+			&i.Url,
+			&i.PublishedAt,
+			&i.Rank,
 		); err != nil {
 			return nil, err
 		}
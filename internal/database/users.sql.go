@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,7 +21,7 @@ VALUES (
     $3,
     $4
 )
-RETURNING id, created_at, updated_at, name
+RETURNING id, created_at, updated_at, name, email, digest_frequency, last_digest_at
 `
 
 type CreateUserParams struct {
@@ -43,6 +44,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.Email,
+		&i.DigestFrequency,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
@@ -56,8 +60,50 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const getDueDigestUsers = `-- name: GetDueDigestUsers :many
+SELECT id, created_at, updated_at, name, email, digest_frequency, last_digest_at FROM users
+WHERE email IS NOT NULL
+AND digest_frequency IS NOT NULL
+AND (
+    last_digest_at IS NULL
+    OR last_digest_at <= $1::timestamp - CASE WHEN digest_frequency = 'weekly' THEN INTERVAL '7 days' ELSE INTERVAL '1 day' END
+)
+ORDER BY name
+`
+
+func (q *Queries) GetDueDigestUsers(ctx context.Context, now time.Time) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getDueDigestUsers, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Email,
+			&i.DigestFrequency,
+			&i.LastDigestAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, name FROM users
+SELECT id, created_at, updated_at, name, email, digest_frequency, last_digest_at FROM users
 WHERE name = $1 LIMIT 1
 `
 
@@ -69,6 +115,9 @@ func (q *Queries) GetUser(ctx context.Context, name string) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.Email,
+		&i.DigestFrequency,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
@@ -99,3 +148,36 @@ func (q *Queries) GetUsers(ctx context.Context) ([]string, error) {
 	}
 	return items, nil
 }
+
+const markDigestSent = `-- name: MarkDigestSent :exec
+UPDATE users
+SET last_digest_at = $2
+WHERE id = $1
+`
+
+type MarkDigestSentParams struct {
+	ID           uuid.UUID
+	LastDigestAt sql.NullTime
+}
+
+func (q *Queries) MarkDigestSent(ctx context.Context, arg MarkDigestSentParams) error {
+	_, err := q.db.ExecContext(ctx, markDigestSent, arg.ID, arg.LastDigestAt)
+	return err
+}
+
+const setUserDigest = `-- name: SetUserDigest :exec
+UPDATE users
+SET updated_at = CURRENT_TIMESTAMP, email = $2, digest_frequency = $3
+WHERE id = $1
+`
+
+type SetUserDigestParams struct {
+	ID              uuid.UUID
+	Email           sql.NullString
+	DigestFrequency sql.NullString
+}
+
+func (q *Queries) SetUserDigest(ctx context.Context, arg SetUserDigestParams) error {
+	_, err := q.db.ExecContext(ctx, setUserDigest, arg.ID, arg.Email, arg.DigestFrequency)
+	return err
+}
@@ -0,0 +1,277 @@
+// Package htmltext cleans up the HTML found in feed items. Sanitize reduces
+// it to a small allow-list of tags before it is stored, and Render turns it
+// into wrapped plain text for the terminal.
+//
+// Feed HTML is tokenized with golang.org/x/net/html, which copes with the
+// tag soup real feeds contain the way a browser would: stray "<" and "&"
+// are text and unmatched end tags are ignored.
+package htmltext
+
+import (
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// allowedTags are the elements Sanitize keeps. Anything else is unwrapped,
+// keeping its text, unless it is in droppedTags.
+var allowedTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "blockquote": true, "br": true,
+	"code": true, "dd": true, "del": true, "div": true, "dl": true,
+	"dt": true, "em": true, "figcaption": true, "figure": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+	"i": true, "img": true, "ins": true, "li": true, "ol": true, "p": true,
+	"pre": true, "q": true, "s": true, "small": true, "strong": true,
+	"sub": true, "sup": true, "table": true, "tbody": true, "td": true,
+	"tfoot": true, "th": true, "thead": true, "tr": true, "u": true,
+	"ul": true,
+}
+
+// droppedTags are removed along with everything inside them.
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true,
+	"embed": true, "noscript": true, "template": true, "svg": true,
+	"math": true, "form": true, "head": true, "title": true,
+	"button": true, "select": true, "textarea": true,
+}
+
+// voidTags never have content or an end tag.
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// impliedEnds lists, for tags whose end tag HTML lets authors leave out,
+// the open tags a new one closes: "<li>a<li>b" is two items, not nested ones.
+var impliedEnds = map[string][]string{
+	"li": {"li"}, "p": {"p"}, "dt": {"dt", "dd"}, "dd": {"dt", "dd"},
+	"tr": {"tr", "td", "th"}, "td": {"td", "th"}, "th": {"td", "th"},
+}
+
+// trackerHosts serve tracking pixels that show up in feed content.
+var trackerHosts = []string{"feeds.feedburner.com", "pixel.wp.com", "stats.wordpress.com"}
+
+type tokenKind int
+
+const (
+	startToken tokenKind = iota
+	endToken
+	textToken
+)
+
+// token is a start tag, end tag or run of unescaped text. Tag names are
+// lower case.
+type token struct {
+	kind  tokenKind
+	name  string
+	attrs []html.Attribute
+	text  string
+}
+
+// tokenize feeds the tokens of src to fn. Self-closing tags get an end token
+// unless they are void, and comments and doctypes are skipped.
+func tokenize(src string, fn func(token)) {
+	// Control characters have no business in text, and the escape
+	// character in particular could reach a terminal.
+	z := html.NewTokenizer(strings.NewReader(stripControl(src)))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return
+		case html.TextToken:
+			fn(token{kind: textToken, text: string(z.Text())})
+		case html.StartTagToken:
+			t := z.Token()
+			fn(token{kind: startToken, name: t.Data, attrs: t.Attr})
+		case html.SelfClosingTagToken:
+			t := z.Token()
+			fn(token{kind: startToken, name: t.Data, attrs: t.Attr})
+			if !voidTags[t.Data] {
+				fn(token{kind: endToken, name: t.Data})
+			}
+		case html.EndTagToken:
+			t := z.Token()
+			fn(token{kind: endToken, name: t.Data})
+		}
+	}
+}
+
+// skipper tracks whether tokens are inside a dropped element. It counts
+// only tags of the same name, so broken markup inside, like an unclosed
+// <path> in an <svg>, can't leave everything after it dropped.
+type skipper struct {
+	name  string
+	depth int
+}
+
+// skip reports whether tok is inside, or is the start or end of, a dropped
+// element.
+func (s *skipper) skip(tok token) bool {
+	if s.depth == 0 {
+		if tok.kind == startToken && droppedTags[tok.name] && !voidTags[tok.name] {
+			s.name, s.depth = tok.name, 1
+			return true
+		}
+		return tok.kind != textToken && droppedTags[tok.name]
+	}
+	if tok.name == s.name {
+		switch tok.kind {
+		case startToken:
+			s.depth++
+		case endToken:
+			s.depth--
+		}
+	}
+	return true
+}
+
+// Sanitize returns src reduced to the allowed tags. Scripts, styles and
+// embedded content are removed with their contents, attributes are dropped
+// apart from link targets and image sources with safe schemes, and tracking
+// pixels are removed. Every tag the result opens is closed, in order, so
+// broken markup can't spill into whatever it is later embedded in.
+func Sanitize(src string) string {
+	var b strings.Builder
+	var skip skipper
+	var open []string
+
+	closeTo := func(i int) {
+		for len(open) > i {
+			b.WriteString("</" + open[len(open)-1] + ">")
+			open = open[:len(open)-1]
+		}
+	}
+
+	tokenize(src, func(tok token) {
+		if skip.skip(tok) {
+			return
+		}
+
+		switch tok.kind {
+		case startToken:
+			name := tok.name
+			if !allowedTags[name] {
+				return
+			}
+			if name == "img" && isTrackingPixel(tok.attrs) {
+				return
+			}
+
+			if len(open) > 0 && slices.Contains(impliedEnds[name], open[len(open)-1]) {
+				closeTo(len(open) - 1)
+			}
+
+			b.WriteString("<" + name)
+			for _, attr := range tok.attrs {
+				if !allowedAttr(name, attr.Key) {
+					continue
+				}
+				value := attr.Val
+				if attr.Key == "href" || attr.Key == "src" {
+					value = SafeURL(value)
+					if value == "" {
+						continue
+					}
+				}
+				b.WriteString(" " + attr.Key + `="` + html.EscapeString(CleanText(value)) + `"`)
+			}
+			b.WriteString(">")
+			if !voidTags[name] {
+				open = append(open, name)
+			}
+		case endToken:
+			if !allowedTags[tok.name] || voidTags[tok.name] {
+				return
+			}
+			// An end tag closes the innermost open tag of that name and
+			// anything left open inside it; one with nothing to close is
+			// ignored.
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == tok.name {
+					closeTo(i)
+					return
+				}
+			}
+		case textToken:
+			b.WriteString(html.EscapeString(tok.text))
+		}
+	})
+	closeTo(0)
+
+	return strings.TrimSpace(b.String())
+}
+
+func allowedAttr(tag, attr string) bool {
+	switch tag {
+	case "a":
+		return attr == "href" || attr == "title"
+	case "img":
+		return attr == "src" || attr == "alt" || attr == "title"
+	case "abbr":
+		return attr == "title"
+	}
+	return false
+}
+
+func isTrackingPixel(attrs []html.Attribute) bool {
+	for _, attr := range attrs {
+		switch attr.Key {
+		case "width", "height":
+			size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(attr.Val), "px"))
+			if err == nil && size <= 1 {
+				return true
+			}
+		case "src":
+			parsed, err := url.Parse(attr.Val)
+			if err != nil {
+				continue
+			}
+			for _, host := range trackerHosts {
+				if strings.EqualFold(parsed.Hostname(), host) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// SafeURL returns link if it is an absolute http, https or mailto url, and ""
+// otherwise, so javascript: and data: links never survive.
+func SafeURL(link string) string {
+	link = strings.TrimSpace(link)
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return link
+	}
+	return ""
+}
+
+// CleanText removes control characters and collapses whitespace, for plain
+// text fields like titles.
+func CleanText(text string) string {
+	return strings.Join(strings.Fields(stripControl(text)), " ")
+}
+
+// stripControl drops control characters, including the escape character
+// that starts terminal escape sequences. Tabs and newlines are kept.
+func stripControl(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
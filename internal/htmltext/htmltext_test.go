@@ -0,0 +1,178 @@
+package htmltext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"allowed tags kept", "<p>Hello <b>world</b></p>", "<p>Hello <b>world</b></p>"},
+		{"unknown tags unwrapped", "<section><span>text</span></section>", "text"},
+		{"script removed", "<p>a</p><script>alert(1)</script><p>b</p>", "<p>a</p><p>b</p>"},
+		{"style removed", "<style>p { color: red }</style><p>text</p>", "<p>text</p>"},
+		{"nested svg removed", "<svg><svg><path></svg>still svg</svg>after", "after"},
+		{"attributes dropped", `<p class="x" onclick="evil()">text</p>`, "<p>text</p>"},
+		{"safe link kept", `<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"javascript link dropped", `<a href="javascript:alert(1)">x</a>`, "<a>x</a>"},
+		{"data image dropped", `<img src="data:image/png;base64,AAAA" alt="pic">`, `<img alt="pic">`},
+		{"tracking pixel by size", `<p>a<img src="https://example.com/p.gif" width="1" height="1"></p>`, "<p>a</p>"},
+		{"tracking pixel by host", `<img src="https://pixel.wp.com/g.gif">`, ""},
+		{"image kept", `<img src="https://example.com/cat.jpg" width="300">`, `<img src="https://example.com/cat.jpg">`},
+		{"escape characters removed", "<p>evil\x1b[2J\x07text</p>", "<p>evil[2Jtext</p>"},
+		{"bare < and & are text", "<p>1 < 2 && 3 > 2</p>", "<p>1 &lt; 2 &amp;&amp; 3 &gt; 2</p>"},
+		{"stray end tags ignored", "<p>a</p></div></div><p>b</p>", "<p>a</p><p>b</p>"},
+		{"unclosed tags closed", "<p><b>bold", "<p><b>bold</b></p>"},
+		{"end tag closes what's inside", "<ul><li><b>a</ul>b", "<ul><li><b>a</b></li></ul>b"},
+		{"implied end tags", "<ul><li>a<li>b</ul>", "<ul><li>a</li><li>b</li></ul>"},
+		{"entities decoded and re-escaped", "<p>&amp; &lt;tag&gt; &eacute;</p>", "<p>&amp; &lt;tag&gt; é</p>"},
+		{"comments dropped", "<p>a<!-- hidden -->b</p>", "<p>ab</p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.in); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{" http://example.com ", "http://example.com"},
+		{"mailto:me@example.com", "mailto:me@example.com"},
+		{"javascript:alert(1)", ""},
+		{"JavaScript:alert(1)", ""},
+		{"data:text/html;base64,PHNjcmlwdD4=", ""},
+		{"/relative/path", ""},
+		{"ftp://example.com/file", ""},
+		{"http://[::1", ""},
+	}
+
+	for _, tt := range tests {
+		if got := SafeURL(tt.in); got != tt.want {
+			t.Errorf("SafeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"<p>Hello <b>world</b></p><p>Next</p>", "Hello world Next"},
+		{"<p>1 < 2 && 3 > 2</p>", "1 < 2 && 3 > 2"},
+		{"<p>a</p></div></div><p>b</p>", "a b"},
+		{"<script>alert(1)</script>text<style>p {}</style>", "text"},
+		{`<img src="https://example.com/cat.jpg" alt="a cat">`, "a cat"},
+		{`<img src="https://example.com/p.gif" alt="pixel" width="1">`, ""},
+		{"<ul><li>one<li>two</ul>", "one two"},
+		{"evil\x1b]8;;https://x\x1b\\link &amp; more", "evil]8;;https://x\\link & more"},
+	}
+
+	for _, tt := range tests {
+		if got := PlainText(tt.in); got != tt.want {
+			t.Errorf("PlainText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		opts Options
+		want string
+	}{
+		{
+			name: "paragraphs",
+			in:   "<p>One</p><p>Two</p>",
+			want: "One\n\nTwo",
+		},
+		{
+			name: "wrapping",
+			in:   "<p>the quick brown fox jumps</p>",
+			opts: Options{Width: 10},
+			want: "the quick\nbrown fox\njumps",
+		},
+		{
+			name: "lists",
+			in:   "<ul><li>a<li>b</ul><ol><li>c</li><li>d</li></ol>",
+			want: "* a\n* b\n\n1. c\n2. d",
+		},
+		{
+			name: "blockquote and heading",
+			in:   "<h2>Title</h2><blockquote>quoted</blockquote>",
+			want: "## Title\n\n> quoted",
+		},
+		{
+			name: "preformatted",
+			in:   "<pre>a  b\n\tc</pre>",
+			want: "    a  b\n        c",
+		},
+		{
+			name: "links as footnotes",
+			in:   `<p><a href="https://example.com">site</a> and <a href="https://example.org">https://example.org</a></p>`,
+			want: "site[1] and https://example.org\n\n[1] https://example.com",
+		},
+		{
+			name: "unsafe link has no footnote",
+			in:   `<a href="javascript:alert(1)">click</a>`,
+			want: "click",
+		},
+		{
+			name: "osc 8 hyperlinks",
+			in:   `<a href="https://example.com">site</a>`,
+			opts: Options{Hyperlinks: true},
+			want: "\x1b]8;;https://example.com\x1b\\site\x1b]8;;\x1b\\[1]\n\n" +
+				"[1] \x1b]8;;https://example.com\x1b\\https://example.com\x1b]8;;\x1b\\",
+		},
+		{
+			name: "escape characters removed",
+			in:   "<p>evil\x1b]8;;https://x\x1b\\text\u009b2J</p>",
+			want: "evil]8;;https://x\\text2J",
+		},
+		{
+			name: "script and style removed",
+			in:   "<p>a</p><script>document.write('<p>x</p>')</script><style>p{}</style><p>b</p>",
+			want: "a\n\nb",
+		},
+		{
+			name: "images and tracking pixels",
+			in:   `<p>see <img src="https://example.com/cat.jpg" alt="cat"><img src="https://stats.wordpress.com/b.gif" alt="t"></p>`,
+			want: "see [image: cat]",
+		},
+		{
+			name: "bare < and &",
+			in:   "<p>1 < 2 && 3 > 2</p><p>next</p>",
+			want: "1 < 2 && 3 > 2\n\nnext",
+		},
+		{
+			name: "stray end tags",
+			in:   "<p>a</p></div></div><p>b</p>",
+			want: "a\n\nb",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.in, tt.opts)
+			if got != tt.want {
+				t.Errorf("Render(%q) =\n%q\nwant\n%q", tt.in, got, tt.want)
+			}
+			if !tt.opts.Hyperlinks && strings.ContainsRune(got, '\x1b') {
+				t.Errorf("Render(%q) contains an escape character without Hyperlinks", tt.in)
+			}
+		})
+	}
+}
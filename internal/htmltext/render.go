@@ -0,0 +1,390 @@
+package htmltext
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Options control how Render lays out text.
+type Options struct {
+	// Width wraps lines to this many columns. Zero means no wrapping.
+	Width int
+	// Hyperlinks wraps link text in OSC 8 escape sequences so terminals that
+	// support them make it clickable.
+	Hyperlinks bool
+}
+
+// blockTags start a new paragraph when they open or close.
+var blockTags = map[string]bool{
+	"blockquote": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "ol": true, "p": true, "table": true,
+	"ul": true,
+}
+
+// segment is a run of inline text, with the link it belongs to if any.
+type segment struct {
+	text string
+	href string
+}
+
+type list struct {
+	ordered  bool
+	n        int
+	openItem bool
+}
+
+type renderer struct {
+	opts Options
+
+	lines     []string
+	needBlank bool
+
+	inline   []segment
+	prefixes []string
+	// marker replaces the innermost prefix on the next line written, so a
+	// list item's first line gets its bullet and the rest are indented.
+	marker string
+	lists  []list
+
+	preDepth int
+	pre      strings.Builder
+	cells    int
+
+	href      string
+	linkText  strings.Builder
+	footnotes []string
+	footnote  map[string]int
+}
+
+// Render turns feed HTML into plain text: paragraphs wrapped to
+// opts.Width, list bullets, quoted blockquotes and preformatted blocks kept
+// as they are. Links are numbered and listed as footnotes at the end, unless
+// their text is the url itself. Control characters are removed, so the
+// result is safe to print to a terminal apart from the OSC 8 sequences
+// added with opts.Hyperlinks.
+func Render(src string, opts Options) string {
+	r := render(src, opts)
+	if len(r.footnotes) > 0 {
+		r.needBlank = true
+		for i, link := range r.footnotes {
+			r.writeLine("[" + strconv.Itoa(i+1) + "] " + r.hyperlink(link, link))
+		}
+	}
+	return strings.Join(r.lines, "\n")
+}
+
+// PlainText reduces src to a single line of text with no markup at all, for
+// listings.
+func PlainText(src string) string {
+	var b strings.Builder
+	var skip skipper
+	tokenize(src, func(tok token) {
+		if skip.skip(tok) {
+			return
+		}
+		switch tok.kind {
+		case startToken:
+			if tok.name == "img" && !isTrackingPixel(tok.attrs) {
+				b.WriteString(" " + attr(tok.attrs, "alt") + " ")
+			}
+			if blockTags[tok.name] || tok.name == "br" || tok.name == "li" || tok.name == "td" || tok.name == "th" {
+				b.WriteString(" ")
+			}
+		case endToken:
+			if blockTags[tok.name] {
+				b.WriteString(" ")
+			}
+		case textToken:
+			b.WriteString(tok.text)
+		}
+	})
+	return CleanText(b.String())
+}
+
+func render(src string, opts Options) *renderer {
+	r := &renderer{opts: opts, footnote: map[string]int{}}
+	var skip skipper
+	tokenize(src, func(tok token) {
+		if skip.skip(tok) {
+			return
+		}
+		switch tok.kind {
+		case startToken:
+			r.start(tok.name, tok.attrs)
+		case endToken:
+			r.end(tok.name)
+		case textToken:
+			r.text(tok.text)
+		}
+	})
+	r.flush()
+	return r
+}
+
+func (r *renderer) start(name string, attrs []html.Attribute) {
+	switch {
+	case name == "pre":
+		r.block()
+		r.preDepth++
+	case name == "li":
+		r.closeItem()
+		r.flush()
+		if len(r.lists) == 0 {
+			r.lists = append(r.lists, list{})
+		}
+		l := &r.lists[len(r.lists)-1]
+		l.n++
+		l.openItem = true
+		r.marker = "* "
+		if l.ordered {
+			r.marker = strconv.Itoa(l.n) + ". "
+		}
+		r.prefixes = append(r.prefixes, strings.Repeat(" ", len(r.marker)))
+	case blockTags[name]:
+		r.block()
+		switch name {
+		case "blockquote":
+			r.prefixes = append(r.prefixes, "> ")
+		case "ul", "ol":
+			r.lists = append(r.lists, list{ordered: name == "ol"})
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			level := int(name[1] - '0')
+			r.inline = append(r.inline, segment{text: strings.Repeat("#", level) + " "})
+		}
+	case name == "br":
+		r.flush()
+	case name == "hr":
+		r.block()
+		r.writeLine("---")
+	case name == "tr":
+		r.flush()
+		r.cells = 0
+	case name == "td" || name == "th":
+		if r.cells > 0 {
+			r.inline = append(r.inline, segment{text: " | "})
+		}
+		r.cells++
+	case name == "q":
+		r.text(`"`)
+	case name == "img":
+		if isTrackingPixel(attrs) {
+			return
+		}
+		alt := CleanText(attr(attrs, "alt"))
+		if alt == "" {
+			r.text(" [image] ")
+		} else {
+			r.text(" [image: " + alt + "] ")
+		}
+	case name == "a":
+		r.href = SafeURL(attr(attrs, "href"))
+		r.linkText.Reset()
+	}
+}
+
+func (r *renderer) end(name string) {
+	switch {
+	case name == "pre":
+		if r.preDepth > 0 {
+			r.preDepth--
+		}
+		if r.preDepth == 0 {
+			text := strings.Trim(r.pre.String(), "\n")
+			r.pre.Reset()
+			for _, line := range strings.Split(text, "\n") {
+				r.writeLine("    " + strings.TrimRight(line, " \t"))
+			}
+			r.needBlank = true
+		}
+	case name == "li":
+		r.closeItem()
+	case blockTags[name]:
+		r.block()
+		switch name {
+		case "blockquote":
+			r.popPrefix("> ")
+		case "ul", "ol":
+			r.closeItem()
+			if len(r.lists) > 0 {
+				r.lists = r.lists[:len(r.lists)-1]
+			}
+		}
+	case name == "q":
+		r.text(`"`)
+	case name == "a":
+		r.endLink()
+	}
+}
+
+func (r *renderer) text(text string) {
+	text = stripControl(text)
+	if r.preDepth > 0 {
+		r.pre.WriteString(strings.ReplaceAll(text, "\t", "    "))
+		return
+	}
+	if r.href != "" {
+		r.linkText.WriteString(text)
+	}
+	r.inline = append(r.inline, segment{text: text, href: r.href})
+}
+
+// endLink numbers the link that just closed and marks its text with the
+// footnote. Links whose text is the url need no footnote.
+func (r *renderer) endLink() {
+	href := r.href
+	r.href = ""
+	if href == "" {
+		return
+	}
+
+	text := CleanText(r.linkText.String())
+	if text == href || text == strings.TrimPrefix(href, "mailto:") {
+		return
+	}
+	n, ok := r.footnote[href]
+	if !ok {
+		r.footnotes = append(r.footnotes, href)
+		n = len(r.footnotes)
+		r.footnote[href] = n
+	}
+	r.inline = append(r.inline, segment{text: "[" + strconv.Itoa(n) + "]"})
+}
+
+func (r *renderer) closeItem() {
+	if len(r.lists) == 0 || !r.lists[len(r.lists)-1].openItem {
+		return
+	}
+	r.flush()
+	r.lists[len(r.lists)-1].openItem = false
+	r.marker = ""
+	if len(r.prefixes) > 0 {
+		r.prefixes = r.prefixes[:len(r.prefixes)-1]
+	}
+}
+
+func (r *renderer) popPrefix(prefix string) {
+	for i := len(r.prefixes) - 1; i >= 0; i-- {
+		if r.prefixes[i] == prefix {
+			r.prefixes = append(r.prefixes[:i], r.prefixes[i+1:]...)
+			return
+		}
+	}
+}
+
+// block ends the current paragraph and asks for a blank line before the
+// next one.
+func (r *renderer) block() {
+	r.flush()
+	r.needBlank = true
+}
+
+// flush wraps the pending inline text into lines.
+func (r *renderer) flush() {
+	words := r.words()
+	r.inline = r.inline[:0]
+	if len(words) == 0 {
+		return
+	}
+
+	width := r.opts.Width - utf8.RuneCountInString(strings.Join(r.prefixes, ""))
+	line, lineWidth := "", 0
+	for _, w := range words {
+		if lineWidth > 0 && r.opts.Width > 0 && lineWidth+1+w.width > width {
+			r.writeLine(line)
+			line, lineWidth = "", 0
+		}
+		if lineWidth > 0 {
+			line += " "
+			lineWidth++
+		}
+		line += w.text
+		lineWidth += w.width
+	}
+	r.writeLine(line)
+}
+
+type word struct {
+	text  string
+	width int
+}
+
+// words splits the pending inline segments at whitespace. A word can span
+// segments, as in "<b>bold</b>ness", and each linked piece of it is wrapped
+// in its own hyperlink.
+func (r *renderer) words() []word {
+	var words []word
+	var current word
+	var piece strings.Builder
+	pieceHref := ""
+
+	endPiece := func() {
+		if piece.Len() > 0 {
+			current.text += r.hyperlink(piece.String(), pieceHref)
+			piece.Reset()
+		}
+	}
+	endWord := func() {
+		endPiece()
+		if current.width > 0 {
+			words = append(words, current)
+		}
+		current = word{}
+	}
+
+	for _, seg := range r.inline {
+		if seg.href != pieceHref {
+			endPiece()
+			pieceHref = seg.href
+		}
+		for _, c := range seg.text {
+			if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+				endWord()
+				continue
+			}
+			piece.WriteRune(c)
+			current.width++
+		}
+	}
+	endWord()
+	return words
+}
+
+func (r *renderer) hyperlink(text, href string) string {
+	if !r.opts.Hyperlinks || href == "" {
+		return text
+	}
+	return "\x1b]8;;" + href + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+func (r *renderer) writeLine(line string) {
+	if r.needBlank && len(r.lines) > 0 && r.lines[len(r.lines)-1] != "" {
+		// Inside a blockquote the blank line keeps its "> ", but not on
+		// the line that opens the quote.
+		blank := strings.TrimRight(strings.Join(r.prefixes, ""), " ")
+		if !strings.HasPrefix(r.lines[len(r.lines)-1], blank) {
+			blank = ""
+		}
+		r.lines = append(r.lines, blank)
+	}
+	r.needBlank = false
+
+	prefix := strings.Join(r.prefixes, "")
+	if r.marker != "" && len(r.prefixes) > 0 {
+		prefix = strings.Join(r.prefixes[:len(r.prefixes)-1], "") + r.marker
+		r.marker = ""
+	}
+	r.lines = append(r.lines, strings.TrimRight(prefix+line, " "))
+}
+
+func attr(attrs []html.Attribute, name string) string {
+	for _, a := range attrs {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/template"
 
 	"github.com/d-shames3/gator/internal/config"
 	"github.com/d-shames3/gator/internal/database"
@@ -22,7 +29,6 @@ func main() {
 	}
 
 	dbQueries := database.New(db)
-	st := state{dbQueries, &cfg}
 	cmds := commands{make(map[string]func(*state, command) error)}
 
 	err = cmds.register("addfeed", middlewareLoggedIn(handlerAddFeed))
@@ -40,11 +46,36 @@ func main() {
 		log.Fatal(err)
 	}
 
+	err = cmds.register("digest", middlewareLoggedIn(handlerDigest))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("export", middlewareLoggedIn(handlerExport))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = cmds.register("feeds", handlerFeeds)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = cmds.register("fetch", handlerFetch)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("fetchlog", handlerFetchLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("folder", middlewareLoggedIn(handlerFolder))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = cmds.register("follow", middlewareLoggedIn(handlerFollow))
 	if err != nil {
 		log.Fatal(err)
@@ -55,21 +86,101 @@ func main() {
 		log.Fatal(err)
 	}
 
+	err = cmds.register("import", handlerImport)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("later", middlewareLoggedIn(handlerLater))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = cmds.register("login", handlerLogin)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = cmds.register("markread", middlewareLoggedIn(handlerMarkRead))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("notify", middlewareLoggedIn(handlerNotify))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("open", middlewareLoggedIn(handlerOpen))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("preview", handlerPreview)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("publish", middlewareLoggedIn(handlerPublish))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("queue", middlewareLoggedIn(handlerQueue))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("read", middlewareLoggedIn(handlerRead))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = cmds.register("register", handlerRegister)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = cmds.register("rename-follow", middlewareLoggedIn(handlerRenameFollow))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = cmds.register("reset", handlerReset)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	err = cmds.register("rule", middlewareLoggedIn(handlerRule))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("search", middlewareLoggedIn(handlerSearch))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("serve-feed", middlewareLoggedIn(handlerServeFeed))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("star", middlewareLoggedIn(handlerStar))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("starred", middlewareLoggedIn(handlerStarred))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("tui", middlewareLoggedIn(handlerTUI))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	err = cmds.register("users", handlerUsers)
 	if err != nil {
 		log.Fatal(err)
@@ -80,20 +191,105 @@ func main() {
 		log.Fatal(err)
 	}
 
-	argsRaw := os.Args
-	if len(argsRaw) < 2 {
+	err = cmds.register("unread", middlewareLoggedIn(handlerUnread))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("unstar", middlewareLoggedIn(handlerUnstar))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cmds.register("view", middlewareLoggedIn(handlerView))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	globalFlags := flag.NewFlagSet("gator", flag.ExitOnError)
+	timeout := globalFlags.Duration("timeout", 0, "abort one-shot commands after this long, e.g. 30s")
+	format := globalFlags.String("format", "table", "output format for listings: "+strings.Join(outputFormats, ", "))
+	templateText := globalFlags.String("template", "", "go text/template, or the name of a built-in template, used to print listings")
+	globalFlags.Parse(os.Args[1:])
+
+	if !slices.Contains(outputFormats, *format) {
+		log.Fatalf("--format must be one of %s", strings.Join(outputFormats, ", "))
+	}
+
+	argsRaw := globalFlags.Args()
+	if len(argsRaw) < 1 {
 		log.Fatalln("no command line args provided")
 	}
 
 	args := make([]string, 0)
-	cmdName := argsRaw[1]
-	if len(argsRaw) > 2 {
-		args = append(args, argsRaw[2:]...)
+	cmdName := argsRaw[0]
+	if len(argsRaw) > 1 {
+		args = append(args, argsRaw[1:]...)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *timeout > 0 && !longRunningCommands[cmdName] {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	// An explicit --format beats a template saved in the config file, so
+	// scripts asking for json get json.
+	formatSet := false
+	globalFlags.Visit(func(f *flag.Flag) {
+		if f.Name == "format" {
+			formatSet = true
+		}
+	})
+	listingName := templateCommandName(cmdName, args)
+	outputTemplate := *templateText
+	if outputTemplate == "" && !formatSet {
+		outputTemplate = cfg.Templates[listingName]
+	}
+	var tmpl *template.Template
+	if outputTemplate != "" {
+		tmpl, err = parseOutputTemplate(outputTemplate, listingName)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
+	st := state{dbQueries, &cfg, ctx, db, *format, tmpl}
 	command := command{cmdName, args}
 	err = cmds.run(&st, command)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// longRunningCommands are exempt from --timeout; they run until interrupted.
+var longRunningCommands = map[string]bool{
+	"agg":        true,
+	"serve-feed": true,
+	"tui":        true,
+}
+
+// subcommandCommands are the commands whose first argument picks a
+// subcommand, each with its own listing.
+var subcommandCommands = map[string]bool{
+	"digest": true,
+	"export": true,
+	"feeds":  true,
+	"folder": true,
+	"import": true,
+	"notify": true,
+	"rule":   true,
+}
+
+// templateCommandName is the name output templates are saved under for a
+// command line: the command, plus the subcommand for commands that have
+// them, e.g. "rule ls".
+func templateCommandName(cmdName string, args []string) string {
+	if subcommandCommands[cmdName] && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return cmdName + " " + args[0]
+	}
+	return cmdName
+}
@@ -1,14 +1,12 @@
 package main
 
 import (
-	"context"
-
 	"github.com/d-shames3/gator/internal/database"
 )
 
 func middlewareLoggedIn(handler func(s *state, cmd command, user database.User) error) func(s *state, cmd command) error {
 	wrapper := func(s *state, cmd command) error {
-		user, err := s.db.GetUser(context.Background(), s.config.CurrentUserName)
+		user, err := s.db.GetUser(s.ctx, s.config.CurrentUserName)
 		if err != nil {
 			return err
 		}
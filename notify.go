@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+// notifyKinds are the supported sink types: a generic JSON webhook, Slack and
+// Discord incoming webhooks, and a command from the config file's
+// notify_commands that reads the JSON payload on stdin.
+var notifyKinds = []string{"webhook", "slack", "discord", "exec"}
+
+const (
+	// notifyAttempts is how many times a delivery is tried before it is
+	// logged as failed. Retries back off 1s, 2s, ...
+	notifyAttempts = 3
+	// notifyTimeout bounds a single delivery attempt.
+	notifyTimeout = 10 * time.Second
+	// notifyBudget bounds all the deliveries for one fetch, so a dead sink
+	// can't hold up agg or fetch --all.
+	notifyBudget = 30 * time.Second
+	// notifyLogRetention is how many notify_log rows are kept per sink.
+	notifyLogRetention = 100
+)
+
+// notifyPayload is the document sent to webhook and exec sinks.
+type notifyPayload struct {
+	Event string     `json:"event"`
+	User  string     `json:"user"`
+	Feed  string     `json:"feed"`
+	Post  notifyPost `json:"post"`
+}
+
+type notifyPost struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Description string     `json:"description,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Categories  []string   `json:"categories,omitempty"`
+	CommentsURL string     `json:"comments_url,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+}
+
+func newNotifyPayload(userName, feedName string, post database.Post) notifyPayload {
+	payload := notifyPayload{
+		Event: "post.created",
+		User:  userName,
+		Feed:  feedName,
+		Post: notifyPost{
+			ID:          post.ShortID,
+			Title:       post.Title,
+			URL:         post.Url,
+			Description: post.Description.String,
+			Author:      post.Author.String,
+			Categories:  post.Categories,
+			CommentsURL: post.CommentsUrl.String,
+		},
+	}
+	if post.PublishedAt.Valid {
+		payload.Post.PublishedAt = &post.PublishedAt.Time
+	}
+	return payload
+}
+
+// notifyBatch is the new posts from one fetch that are going to one sink.
+type notifyBatch struct {
+	sink       database.NotifySink
+	userName   string
+	deliveries []notifyDelivery
+}
+
+// notifyDelivery is one post waiting to be sent.
+type notifyDelivery struct {
+	postID  uuid.NullUUID
+	payload notifyPayload
+}
+
+// notifyNewPosts sends each newly saved post to the sinks of everyone
+// following feed. Posts a user's rules hid are skipped, as are posts that
+// don't mention a sink's keyword. Failed deliveries are printed and recorded
+// in notify_log rather than returned, so one broken webhook can't stop the
+// aggregator.
+//
+// Sinks are sent to side by side and all of them together get notifyBudget.
+// A sink that fails gets none of the batch's remaining posts, and whatever
+// is left when the budget runs out is logged as not sent.
+func notifyNewPosts(s *state, feed database.Feed, posts []database.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	sinks, err := s.db.GetNotifySinksForFeed(s.ctx, feed.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching notification sinks for %s: %v", feed.Name, err)
+	}
+
+	var batches []notifyBatch
+	for _, sink := range sinks {
+		batch := notifyBatch{
+			sink: database.NotifySink{
+				ID:      sink.ID,
+				ShortID: sink.ShortID,
+				UserID:  sink.UserID,
+				Kind:    sink.Kind,
+				Target:  sink.Target,
+				Keyword: sink.Keyword,
+			},
+			userName: sink.UserName,
+		}
+		for _, post := range posts {
+			if sink.Keyword.Valid && !mentions(post, sink.Keyword.String) {
+				continue
+			}
+
+			hidden, err := s.db.IsPostHidden(s.ctx, database.IsPostHiddenParams{UserID: sink.UserID, PostID: post.ID})
+			if err != nil {
+				return fmt.Errorf("error checking post state for %s: %v", sink.UserName, err)
+			}
+			if hidden {
+				continue
+			}
+
+			batch.deliveries = append(batch.deliveries, notifyDelivery{
+				postID:  uuid.NullUUID{UUID: post.ID, Valid: true},
+				payload: newNotifyPayload(sink.UserName, sink.FeedName, post),
+			})
+		}
+		if len(batch.deliveries) > 0 {
+			batches = append(batches, batch)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, notifyBudget)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, batch := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliverBatch(s, ctx, batch)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// deliverBatch sends a batch's posts in order until one fails or ctx is
+// done, then logs the rest as not sent.
+func deliverBatch(s *state, ctx context.Context, batch notifyBatch) {
+	for i, delivery := range batch.deliveries {
+		if ctx.Err() != nil {
+			logUnsent(s, batch, i, "not sent: notification time limit reached")
+			return
+		}
+
+		err := deliverNotification(s, ctx, batch.sink, delivery.postID, delivery.payload)
+		if err != nil {
+			fmt.Printf("Notification %d for %s failed: %v\n", batch.sink.ShortID, batch.userName, err)
+			logUnsent(s, batch, i+1, "not sent: an earlier delivery to this sink failed")
+			return
+		}
+	}
+}
+
+// logUnsent records the batch's deliveries from index from on as not sent.
+func logUnsent(s *state, batch notifyBatch, from int, reason string) {
+	for _, delivery := range batch.deliveries[from:] {
+		err := logNotification(s, batch.sink, delivery.postID, 0, errors.New(reason))
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+}
+
+func mentions(post database.Post, keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	return strings.Contains(strings.ToLower(post.Title), keyword) ||
+		strings.Contains(strings.ToLower(post.Description.String), keyword)
+}
+
+// deliverNotification sends payload to sink, retrying failed attempts until
+// ctx is done, and records the outcome in notify_log.
+func deliverNotification(s *state, ctx context.Context, sink database.NotifySink, postID uuid.NullUUID, payload notifyPayload) error {
+	attempts := 0
+	var err error
+	for attempts < notifyAttempts {
+		attempts++
+		err = sendNotification(ctx, s.config.NotifyCommands, sink, payload)
+		if err == nil || ctx.Err() != nil || attempts == notifyAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second << (attempts - 1)):
+		}
+	}
+
+	logErr := logNotification(s, sink, postID, attempts, err)
+	if logErr != nil {
+		return logErr
+	}
+	return err
+}
+
+// logNotification records a delivery outcome in notify_log and trims the
+// sink's history. It runs even after s.ctx is cancelled.
+func logNotification(s *state, sink database.NotifySink, postID uuid.NullUUID, attempts int, err error) error {
+	ctx := context.WithoutCancel(s.ctx)
+	logParams := database.CreateNotifyLogParams{
+		ID:          uuid.New(),
+		SinkID:      sink.ID,
+		PostID:      postID,
+		AttemptedAt: time.Now(),
+		Attempts:    int32(attempts),
+	}
+	if err != nil {
+		logParams.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+
+	logErr := s.db.CreateNotifyLog(ctx, logParams)
+	if logErr != nil {
+		return fmt.Errorf("error recording notification %d: %v", sink.ShortID, logErr)
+	}
+
+	logErr = s.db.TrimNotifyLog(ctx, database.TrimNotifyLogParams{SinkID: sink.ID, Keep: notifyLogRetention})
+	if logErr != nil {
+		return fmt.Errorf("error trimming notification log for %d: %v", sink.ShortID, logErr)
+	}
+
+	return nil
+}
+
+// sendNotification makes a single delivery attempt. Exec sinks run the
+// command their target names in commands.
+func sendNotification(ctx context.Context, commands map[string]string, sink database.NotifySink, payload notifyPayload) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	var body any = payload
+	switch sink.Kind {
+	case "slack":
+		text := fmt.Sprintf("*%s*: <%s|%s>", slackEscape(payload.Feed), slackEscapeURL(payload.Post.URL), slackEscape(payload.Post.Title))
+		body = map[string]string{"text": text}
+	case "discord":
+		content := fmt.Sprintf("**%s**: %s\n%s", discordEscape(payload.Feed), discordEscape(payload.Post.Title), payload.Post.URL)
+		// Feed text is untrusted, so nothing in it may ping anyone, even
+		// if it gets a mention past the escaping.
+		body = map[string]any{
+			"content":          content,
+			"allowed_mentions": map[string][]string{"parse": {}},
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+
+	if sink.Kind == "exec" {
+		command, ok := commands[sink.Target]
+		if !ok {
+			return fmt.Errorf("no command named %s in the config file's notify_commands", sink.Target)
+		}
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(data)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("command failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sink.Target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating notification request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gator")
+
+	client := http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status from %s: %s", sink.Kind, res.Status)
+	}
+	return nil
+}
+
+var slackReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackEscape escapes the characters Slack treats as control sequences in
+// message text.
+func slackEscape(text string) string {
+	return slackReplacer.Replace(text)
+}
+
+// slackEscapeURL escapes a url for the url part of a <url|text> link, where
+// a "|" would end the url early.
+func slackEscapeURL(link string) string {
+	return slackEscape(strings.ReplaceAll(link, "|", "%7C"))
+}
+
+var discordReplacer = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`,
+	">", `\>`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "<", `\<`, "@", `\@`,
+)
+
+// discordEscape escapes Markdown and mentions in Discord message text.
+func discordEscape(text string) string {
+	return discordReplacer.Replace(text)
+}
+
+// validateNotifyTarget checks a sink target before it is saved: webhook kinds
+// need an http(s) url, exec needs the name of a command.
+func validateNotifyTarget(kind, target string) error {
+	if kind == "exec" {
+		if strings.TrimSpace(target) == "" || strings.ContainsAny(target, " \t\n") {
+			return fmt.Errorf("exec sinks need the name of a command from the config file's notify_commands, got %q", target)
+		}
+		return nil
+	}
+
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s sinks need an http or https url, got %s", kind, target)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d-shames3/gator/internal/database"
+)
+
+func TestSendNotificationSlackEscapesLink(t *testing.T) {
+	var got map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	payload := notifyPayload{
+		Feed: "R&D",
+		Post: notifyPost{
+			Title: "a <b> | c",
+			URL:   "https://example.com/a?x=1|2&y=<3>",
+		},
+	}
+	sink := database.NotifySink{Kind: "slack", Target: server.URL}
+	err := sendNotification(context.Background(), nil, sink, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "*R&amp;D*: <https://example.com/a?x=1%7C2&amp;y=&lt;3&gt;|a &lt;b&gt; | c>"
+	if got["text"] != want {
+		t.Errorf("slack text = %q, want %q", got["text"], want)
+	}
+}
+
+func TestSendNotificationDiscordEscapesMentions(t *testing.T) {
+	var got struct {
+		Content         string              `json:"content"`
+		AllowedMentions map[string][]string `json:"allowed_mentions"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	payload := notifyPayload{
+		Feed: "**R&D**",
+		Post: notifyPost{
+			Title: "@everyone <@&123> [click](https://evil) _now_",
+			URL:   "https://example.com/a",
+		},
+	}
+	sink := database.NotifySink{Kind: "discord", Target: server.URL}
+	err := sendNotification(context.Background(), nil, sink, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `**\*\*R&D\*\***: \@everyone \<\@&123\> \[click\]\(https://evil\) \_now\_` + "\nhttps://example.com/a"
+	if got.Content != want {
+		t.Errorf("discord content = %q, want %q", got.Content, want)
+	}
+	parse, ok := got.AllowedMentions["parse"]
+	if !ok || len(parse) != 0 {
+		t.Errorf("allowed_mentions = %v, want an empty parse list", got.AllowedMentions)
+	}
+}
+
+func TestSendNotificationExecNeedsConfiguredCommand(t *testing.T) {
+	sink := database.NotifySink{Kind: "exec", Target: "say"}
+
+	err := sendNotification(context.Background(), nil, sink, notifyPayload{})
+	if err == nil || !strings.Contains(err.Error(), "notify_commands") {
+		t.Errorf("unconfigured command: error = %v, want one naming notify_commands", err)
+	}
+
+	commands := map[string]string{"say": "cat >/dev/null"}
+	err = sendNotification(context.Background(), commands, sink, notifyPayload{})
+	if err != nil {
+		t.Errorf("configured command: error = %v", err)
+	}
+}
+
+func TestValidateNotifyTarget(t *testing.T) {
+	tests := []struct {
+		kind    string
+		target  string
+		wantErr bool
+	}{
+		{"webhook", "https://example.com/hook", false},
+		{"slack", "ftp://example.com/hook", true},
+		{"discord", "not a url", true},
+		{"exec", "notify-desktop", false},
+		{"exec", "", true},
+		{"exec", "curl -d @- https://example.com", true},
+	}
+
+	for _, tt := range tests {
+		err := validateNotifyTarget(tt.kind, tt.target)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateNotifyTarget(%s, %q) error = %v, want error %v", tt.kind, tt.target, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/d-shames3/gator/internal/htmltext"
+	"github.com/google/uuid"
+)
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// subscription is a feed to follow, as found in an OPML file or another
+// reader's export.
+type subscription struct {
+	url    string
+	title  string
+	folder string
+}
+
+// subscriptionChange is what importing one subscription does: "create" adds
+// the feed and follows it, "follow" follows a feed gator already has, "move"
+// changes the folder of an existing follow, and "unchanged" and "invalid"
+// do nothing.
+type subscriptionChange struct {
+	subscription
+	action   string
+	feedID   uuid.UUID
+	followed bool
+}
+
+// readImportFile reads the file an import command was given, or stdin when
+// the name is "-".
+func readImportFile(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", name, err)
+	}
+	return data, nil
+}
+
+// parseOPML returns the feeds in an OPML document. Outlines without an
+// xmlUrl are folders; nested folders are joined with "/".
+func parseOPML(data []byte) ([]subscription, error) {
+	var doc opmlDocument
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	err := decoder.Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing opml: %v", err)
+	}
+
+	var subs []subscription
+	var walk func(outlines []opmlOutline, folder string)
+	walk = func(outlines []opmlOutline, folder string) {
+		for _, outline := range outlines {
+			title := htmltext.CleanText(outline.Title)
+			if title == "" {
+				title = htmltext.CleanText(outline.Text)
+			}
+
+			if outline.XMLURL == "" {
+				inner := folder
+				if title != "" {
+					inner = strings.TrimPrefix(folder+"/"+title, "/")
+				}
+				walk(outline.Outlines, inner)
+				continue
+			}
+
+			subs = append(subs, subscription{
+				url:    strings.TrimSpace(outline.XMLURL),
+				title:  title,
+				folder: folder,
+			})
+			// Some readers nest feeds under feeds; keep them in the
+			// same folder.
+			walk(outline.Outlines, folder)
+		}
+	}
+	walk(doc.Body.Outlines, "")
+	return subs, nil
+}
+
+// planSubscriptions works out what importing subs would change for user
+// without changing anything, reading through db.
+func planSubscriptions(s *state, db *database.Queries, user database.User, subs []subscription) ([]subscriptionChange, error) {
+	follows, err := db.GetFeedFollowsForUser(s.ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching follows for user %s: %v", user.Name, err)
+	}
+	followed := make(map[uuid.UUID]database.GetFeedFollowsForUserRow, len(follows))
+	for _, follow := range follows {
+		followed[follow.FeedID] = follow
+	}
+
+	// The same feed can be listed more than once, e.g. in a subscription
+	// list and again beside a post. Fill in what the first mention lacks.
+	var unique []subscription
+	index := make(map[string]int)
+	for _, sub := range subs {
+		sub.url = strings.TrimSpace(sub.url)
+		i, ok := index[sub.url]
+		if !ok {
+			index[sub.url] = len(unique)
+			unique = append(unique, sub)
+			continue
+		}
+		if unique[i].title == "" {
+			unique[i].title = sub.title
+		}
+		if unique[i].folder == "" {
+			unique[i].folder = sub.folder
+		}
+	}
+
+	changes := make([]subscriptionChange, 0, len(unique))
+	for _, sub := range unique {
+		change := subscriptionChange{subscription: sub}
+		parsed, err := url.Parse(sub.url)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			change.action = "invalid"
+			changes = append(changes, change)
+			continue
+		}
+		if change.title == "" {
+			change.title = sub.url
+		}
+
+		feed, err := db.GetFeed(s.ctx, sub.url)
+		if errors.Is(err, sql.ErrNoRows) {
+			change.action = "create"
+			changes = append(changes, change)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching feed %s: %v", sub.url, err)
+		}
+		change.feedID = feed.ID
+
+		follow, ok := followed[feed.ID]
+		switch {
+		case !ok:
+			change.action = "follow"
+		case sub.folder != "" && follow.Folder.String != sub.folder:
+			change.action = "move"
+			change.followed = true
+		default:
+			change.action = "unchanged"
+			change.followed = true
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// applySubscriptions makes the planned changes using db, which is normally
+// a transaction so an import either fully happens or not at all.
+func applySubscriptions(s *state, db *database.Queries, user database.User, changes []subscriptionChange) error {
+	for i, change := range changes {
+		now := time.Now()
+		switch change.action {
+		case "create":
+			feed, err := db.CreateFeed(s.ctx, database.CreateFeedParams{
+				ID:        uuid.New(),
+				CreatedAt: now,
+				UpdatedAt: now,
+				Name:      change.title,
+				Url:       change.url,
+				UserID:    user.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("error adding feed %s: %v", change.url, err)
+			}
+			changes[i].feedID = feed.ID
+		case "follow", "move":
+		default:
+			continue
+		}
+
+		if !change.followed {
+			_, err := db.CreateFeedFollows(s.ctx, database.CreateFeedFollowsParams{
+				ID:        uuid.New(),
+				CreatedAt: now,
+				UpdatedAt: now,
+				UserID:    user.ID,
+				FeedID:    changes[i].feedID,
+			})
+			if err != nil {
+				return fmt.Errorf("error following feed %s: %v", change.url, err)
+			}
+		}
+
+		if change.folder != "" {
+			_, err := db.SetFeedFollowFolder(s.ctx, database.SetFeedFollowFolderParams{
+				UserID: user.ID,
+				FeedID: changes[i].feedID,
+				Folder: sql.NullString{String: change.folder, Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("error setting folder for feed %s: %v", change.url, err)
+			}
+		}
+	}
+	return nil
+}
+
+// importSubscriptions plans and applies an import of subs along with any
+// posts and their read and star state, printing each feed's change and a
+// summary. With dryRun nothing is written.
+func importSubscriptions(s *state, user database.User, subs []subscription, posts []importedPost, dryRun bool) error {
+	changes, err := planSubscriptions(s, s.db, user, subs)
+	if err != nil {
+		return err
+	}
+
+	var created, states int
+	if !dryRun {
+		tx, err := s.sqlDB.BeginTx(s.ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %v", err)
+		}
+		defer tx.Rollback()
+		qtx := s.db.WithTx(tx)
+
+		err = applySubscriptions(s, qtx, user, changes)
+		if err != nil {
+			return err
+		}
+
+		created, states, err = importPosts(s, qtx, user, subscriptionFeedIDs(changes), posts)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("error committing import: %v", err)
+		}
+	}
+
+	out := newListing("action", "folder", "feed", "url")
+	out.empty = "No feeds found to import"
+	counts := make(map[string]int)
+	for _, change := range changes {
+		out.add(change.action, change.folder, change.title, change.url)
+		counts[change.action]++
+	}
+	err = out.print(s)
+	if err != nil {
+		return err
+	}
+
+	if s.format != "table" || s.tmpl != nil {
+		return nil
+	}
+	verb := "Imported"
+	if dryRun {
+		verb = "Dry run, would import"
+	}
+	fmt.Printf("%s %d feeds: %d new, %d followed, %d moved, %d unchanged, %d invalid\n",
+		verb, len(changes), counts["create"], counts["follow"], counts["move"], counts["unchanged"], counts["invalid"])
+	if len(posts) > 0 {
+		read, starred := 0, 0
+		for _, post := range posts {
+			if !post.readAt.IsZero() {
+				read++
+			}
+			if !post.starredAt.IsZero() {
+				starred++
+			}
+		}
+		if dryRun {
+			fmt.Printf("Dry run, would import %d posts: %d read, %d starred\n", len(posts), read, starred)
+		} else {
+			fmt.Printf("Imported %d posts (%d new) and %d read or starred states\n", len(posts), created, states)
+		}
+	}
+	return nil
+}
+
+func importOPML(s *state, user database.User, args []string) error {
+	opmlFlags := flag.NewFlagSet("import opml", flag.ContinueOnError)
+	dryRun := opmlFlags.Bool("dry-run", false, "show what would change without changing anything")
+	err := parseFlags(opmlFlags, args)
+	if err != nil {
+		return err
+	}
+	if opmlFlags.NArg() != 1 {
+		return fmt.Errorf("usage: import opml [--dry-run] <file>")
+	}
+
+	data, err := readImportFile(opmlFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	subs, err := parseOPML(data)
+	if err != nil {
+		return err
+	}
+	return importSubscriptions(s, user, subs, nil, *dryRun)
+}
+
+// exportOPML writes the user's follows as OPML 2.0, with one outline per
+// folder.
+func exportOPML(s *state, user database.User, args []string) error {
+	opmlFlags := flag.NewFlagSet("export opml", flag.ContinueOnError)
+	out := opmlFlags.String("out", "", "write to this file instead of stdout")
+	err := parseFlags(opmlFlags, args)
+	if err != nil {
+		return err
+	}
+
+	follows, err := s.db.GetFeedFollowsForUser(s.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching follows for user %s: %v", user.Name, err)
+	}
+
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       fmt.Sprintf("gator subscriptions for %s", user.Name),
+			DateCreated: time.Now().Format(time.RFC1123Z),
+		},
+	}
+	folders := make(map[string]int)
+	for _, follow := range follows {
+		outline := opmlOutline{
+			Text:   follow.Feed,
+			Title:  follow.Feed,
+			Type:   "rss",
+			XMLURL: follow.Url,
+		}
+		if !follow.Folder.Valid {
+			doc.Body.Outlines = append(doc.Body.Outlines, outline)
+			continue
+		}
+
+		i, ok := folders[follow.Folder.String]
+		if !ok {
+			i = len(doc.Body.Outlines)
+			folders[follow.Folder.String] = i
+			doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+				Text:  follow.Folder.String,
+				Title: follow.Folder.String,
+			})
+		}
+		doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, outline)
+	}
+
+	encoded, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding opml: %v", err)
+	}
+	encoded = append([]byte(xml.Header), encoded...)
+	encoded = append(encoded, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(encoded)
+		return err
+	}
+	err = os.WriteFile(*out, encoded, 0o644)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", *out, err)
+	}
+	fmt.Printf("Exported %d feeds to %s\n", len(follows), *out)
+	return nil
+}
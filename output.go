@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// outputFormats are the values the global --format flag accepts.
+var outputFormats = []string{"table", "json", "jsonl", "csv", "tsv"}
+
+// maxTableCell is how many characters of a value table output shows before
+// cutting it short. Other formats always print values in full.
+const maxTableCell = 80
+
+// listing is the output of a listing command. Column names double as JSON
+// keys and CSV headers, so like the column order they should stay stable
+// once released.
+type listing struct {
+	columns []string
+	rows    [][]any
+	// empty is printed instead of an empty table, e.g. "No posts found".
+	// Structured formats print an empty document instead.
+	empty string
+}
+
+func newListing(columns ...string) *listing {
+	return &listing{columns: columns}
+}
+
+// add appends a row. Values may be plain Go values, time.Time, slices of
+// strings, or anything implementing driver.Valuer such as sql.NullString.
+func (l *listing) add(values ...any) {
+	l.rows = append(l.rows, values)
+}
+
+// print writes the listing to stdout using the command's output template if
+// it has one, or else the --format format.
+func (l *listing) print(s *state) error {
+	if s.tmpl != nil {
+		return l.writeTemplate(os.Stdout, s.tmpl)
+	}
+	return l.write(os.Stdout, s.format)
+}
+
+func (l *listing) write(w io.Writer, format string) error {
+	switch format {
+	case "", "table":
+		return l.writeTable(w)
+	case "json":
+		return l.writeJSON(w, false)
+	case "jsonl":
+		return l.writeJSON(w, true)
+	case "csv":
+		return l.writeCSV(w, ',')
+	case "tsv":
+		return l.writeCSV(w, '\t')
+	}
+	return fmt.Errorf("unknown output format %s", format)
+}
+
+func (l *listing) writeTable(w io.Writer) error {
+	if len(l.rows) == 0 && l.empty != "" {
+		_, err := fmt.Fprintln(w, l.empty)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(l.columns, "\t")))
+	for _, row := range l.rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cell := terminalSafe(textValue(value, time.DateTime))
+			if utf8.RuneCountInString(cell) > maxTableCell {
+				cell = string([]rune(cell)[:maxTableCell-1]) + "…"
+			}
+			cells[i] = cell
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeTemplate executes tmpl once per row, passing the row as a map from
+// column name to value. Text values are made terminal safe first, and each
+// row ends up on its own line unless the template ends with a newline itself.
+func (l *listing) writeTemplate(w io.Writer, tmpl *template.Template) error {
+	var out bytes.Buffer
+	for _, row := range l.rows {
+		fields := make(map[string]any, len(row))
+		for i, value := range row {
+			value = jsonValue(value)
+			if text, ok := value.(string); ok {
+				value = terminalSafe(text)
+			}
+			fields[l.columns[i]] = value
+		}
+
+		start := out.Len()
+		err := tmpl.Execute(&out, fields)
+		if err != nil {
+			return fmt.Errorf("error executing output template: %v", err)
+		}
+		if out.Len() == start || out.Bytes()[out.Len()-1] != '\n' {
+			out.WriteString("\n")
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writeJSON writes an array of objects, or with lines one object per line.
+// Objects are built by hand so keys keep the listing's column order.
+func (l *listing) writeJSON(w io.Writer, lines bool) error {
+	var out bytes.Buffer
+	if !lines {
+		out.WriteString("[")
+	}
+	for i, row := range l.rows {
+		if !lines && i > 0 {
+			out.WriteString(",")
+		}
+		if !lines {
+			out.WriteString("\n  ")
+		}
+		out.WriteString("{")
+		for j, value := range row {
+			if j > 0 {
+				out.WriteString(",")
+			}
+			key, err := json.Marshal(l.columns[j])
+			if err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(jsonValue(value))
+			if err != nil {
+				return fmt.Errorf("error encoding %s: %v", l.columns[j], err)
+			}
+			out.Write(key)
+			out.WriteString(":")
+			out.Write(encoded)
+		}
+		out.WriteString("}")
+		if lines {
+			out.WriteString("\n")
+		}
+	}
+	if !lines {
+		if len(l.rows) > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString("]\n")
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func (l *listing) writeCSV(w io.Writer, comma rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	err := cw.Write(l.columns)
+	if err != nil {
+		return err
+	}
+	for _, row := range l.rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			cells[i] = textValue(value, time.RFC3339)
+		}
+		err = cw.Write(cells)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// jsonValue unwraps nullable database values so they encode as the value
+// itself or null.
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return v
+	case []string:
+		if v == nil {
+			return []string{}
+		}
+		return v
+	case driver.Valuer:
+		unwrapped, err := v.Value()
+		if err != nil {
+			return nil
+		}
+		return unwrapped
+	}
+	return value
+}
+
+// textValue renders a value as a single string cell, formatting times with
+// layout and leaving nulls empty.
+func textValue(value any, layout string) string {
+	switch v := jsonValue(value).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Local().Format(layout)
+	case []string:
+		return strings.Join(v, ",")
+	case bool:
+		return strconv.FormatBool(v)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListingWrite(t *testing.T) {
+	published := time.Date(2024, 1, 31, 12, 30, 0, 0, time.UTC)
+	l := newListing("id", "title", "author", "published_at", "tags")
+	l.add(1, `Quotes "and", commas`, sql.NullString{String: "Ann", Valid: true}, published, []string{"go", "db"})
+	l.add(2, "Tab\there\nnewline", sql.NullString{}, sql.NullTime{}, []string(nil))
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "id,title,author,published_at,tags\n" +
+			"1,\"Quotes \"\"and\"\", commas\",Ann," + published.Local().Format(time.RFC3339) + ",\"go,db\"\n" +
+			"2,\"Tab\there\nnewline\",,,\n"},
+		{"tsv", "id\ttitle\tauthor\tpublished_at\ttags\n" +
+			"1\t\"Quotes \"\"and\"\", commas\"\tAnn\t" + published.Local().Format(time.RFC3339) + "\tgo,db\n" +
+			"2\t\"Tab\there\nnewline\"\t\t\t\n"},
+		{"jsonl", `{"id":1,"title":"Quotes \"and\", commas","author":"Ann","published_at":"2024-01-31T12:30:00Z","tags":["go","db"]}` + "\n" +
+			`{"id":2,"title":"Tab\there\nnewline","author":null,"published_at":null,"tags":[]}` + "\n"},
+		{"json", "[\n  " + `{"id":1,"title":"Quotes \"and\", commas","author":"Ann","published_at":"2024-01-31T12:30:00Z","tags":["go","db"]}` + ",\n  " +
+			`{"id":2,"title":"Tab\there\nnewline","author":null,"published_at":null,"tags":[]}` + "\n]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			err := l.write(&out, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("write(%s) =\n%q\nwant\n%q", tt.format, out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestListingWriteEmpty(t *testing.T) {
+	l := newListing("id", "title")
+	l.empty = "No posts found"
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"table", "No posts found\n"},
+		{"json", "[]\n"},
+		{"jsonl", ""},
+		{"csv", "id,title\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		err := l.write(&out, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("empty write(%s) = %q, want %q", tt.format, out.String(), tt.want)
+		}
+	}
+}
+
+func TestListingWriteTable(t *testing.T) {
+	l := newListing("id", "title")
+	l.add(7, strings.Repeat("x", 100))
+	l.add(8, "evil\x1b[2Jtitle\twith\ttabs")
+
+	var out bytes.Buffer
+	err := l.write(&out, "table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("table has %d lines, want 3:\n%s", len(lines), out.String())
+	}
+	if !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[0], "TITLE") {
+		t.Errorf("header = %q", lines[0])
+	}
+	if want := strings.Repeat("x", maxTableCell-1) + "…"; !strings.HasSuffix(lines[1], want) {
+		t.Errorf("long cell = %q, want it cut to %d characters", lines[1], maxTableCell)
+	}
+	if strings.ContainsAny(out.String(), "\x1b") || !strings.HasSuffix(lines[2], "evil[2Jtitle with tabs") {
+		t.Errorf("unsafe cell = %q, want control characters removed", lines[2])
+	}
+}
+
+func TestListingWriteTemplate(t *testing.T) {
+	tmpl, err := parseOutputTemplate(`{{.id}} {{.title}}`, "browse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := newListing("id", "title")
+	l.add(1, "one")
+	l.add(2, "bell\atwo")
+
+	var out bytes.Buffer
+	err = l.writeTemplate(&out, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 one\n2 belltwo\n"; out.String() != want {
+		t.Errorf("writeTemplate = %q, want %q", out.String(), want)
+	}
+}
+
+func TestTerminalSafe(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain text", "plain text"},
+		{"tab\tand\nnewline", "tab and newline"},
+		{"\x1b]8;;https://evil\x1b\\link", "]8;;https://evil\\link"},
+		{"clear\x1b[2J", "clear[2J"},
+		{"c1\u009bcontrol", "c1control"},
+		{"del\x7f", "del"},
+		{"emoji 🐊 and ünïcode", "emoji 🐊 and ünïcode"},
+	}
+
+	for _, tt := range tests {
+		if got := terminalSafe(tt.in); got != tt.want {
+			t.Errorf("terminalSafe(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
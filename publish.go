@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+var publishTypes = []string{"atom", "rss"}
+
+// gatorHome is linked from published feeds that have no public URL of
+// their own.
+const gatorHome = "https://github.com/d-shames3/gator"
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomPerson  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Author     *atomPerson    `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Source     atomSource     `xml:"source"`
+}
+
+type atomSource struct {
+	ID    string     `xml:"id"`
+	Title string     `xml:"title"`
+	Links []atomLink `xml:"link"`
+}
+
+type rssDocument struct {
+	XMLName   xml.Name       `xml:"rss"`
+	Version   string         `xml:"version,attr"`
+	XMLNSAtom string         `xml:"xmlns:atom,attr"`
+	XMLNSDC   string         `xml:"xmlns:dc,attr"`
+	Channel   publishChannel `xml:"channel"`
+}
+
+type publishChannel struct {
+	Title         string        `xml:"title"`
+	Link          string        `xml:"link"`
+	Description   string        `xml:"description"`
+	SelfLink      *atomLink     `xml:"atom:link"`
+	LastBuildDate string        `xml:"lastBuildDate"`
+	Generator     string        `xml:"generator"`
+	Items         []publishItem `xml:"item"`
+}
+
+type publishItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description,omitempty"`
+	Creator     string    `xml:"dc:creator,omitempty"`
+	Categories  []string  `xml:"category"`
+	GUID        rssGUID   `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Source      rssSource `xml:"source"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssSource struct {
+	URL   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+// publishFlags are the flags shared by publish and serve-feed.
+type publishFlags struct {
+	kind   *string
+	folder *string
+	search *string
+	limit  *int
+	url    *string
+	title  *string
+}
+
+func addPublishFlags(fs *flag.FlagSet) publishFlags {
+	return publishFlags{
+		kind:   fs.String("type", "atom", "feed format: "+strings.Join(publishTypes, ", ")),
+		folder: fs.String("folder", "", "only include posts from feeds in this folder"),
+		search: fs.String("search", "", "only include posts matching this search"),
+		limit:  fs.Int("limit", 50, "maximum number of posts to include"),
+		url:    fs.String("url", "", "public url the feed will be served from, used for its self link"),
+		title:  fs.String("title", "", "feed title (default: gator feed for the user)"),
+	}
+}
+
+func (f publishFlags) validate() error {
+	if !slices.Contains(publishTypes, *f.kind) {
+		return fmt.Errorf("--type must be one of %s", strings.Join(publishTypes, ", "))
+	}
+	if *f.limit < 1 || *f.limit > 1000 {
+		return fmt.Errorf("--limit must be between 1 and 1000")
+	}
+	return nil
+}
+
+func (f publishFlags) contentType() string {
+	if *f.kind == "rss" {
+		return "application/rss+xml; charset=utf-8"
+	}
+	return "application/atom+xml; charset=utf-8"
+}
+
+// publishedFeed is a rendered feed document.
+type publishedFeed struct {
+	body    []byte
+	posts   int
+	updated time.Time
+}
+
+// publishFeed renders the newest posts from user's follows, minus hidden
+// ones, as an Atom or RSS 2.0 document.
+func publishFeed(ctx context.Context, s *state, user database.User, f publishFlags) (publishedFeed, error) {
+	params := database.GetPublishedPostsParams{
+		UserID:   user.ID,
+		RowLimit: int32(*f.limit),
+	}
+	if *f.folder != "" {
+		params.Folder = sql.NullString{String: *f.folder, Valid: true}
+	}
+	if *f.search != "" {
+		params.Query = sql.NullString{String: *f.search, Valid: true}
+	}
+	posts, err := s.db.GetPublishedPosts(ctx, params)
+	if err != nil {
+		return publishedFeed{}, fmt.Errorf("error fetching posts for user %s: %v", user.Name, err)
+	}
+
+	title := *f.title
+	if title == "" {
+		title = fmt.Sprintf("gator feed for %s", user.Name)
+	}
+	var filters []string
+	if *f.folder != "" {
+		filters = append(filters, "folder "+*f.folder)
+	}
+	if *f.search != "" {
+		filters = append(filters, fmt.Sprintf("search %q", *f.search))
+	}
+	description := fmt.Sprintf("Posts from the feeds %s follows in gator", user.Name)
+	if len(filters) > 0 {
+		description += " (" + strings.Join(filters, ", ") + ")"
+	}
+
+	// The same user and filters always give the same feed id, whatever the
+	// format, so readers don't see a new feed when the url changes.
+	feedID := uuid.NewSHA1(user.ID, []byte(*f.folder+"\x00"+*f.search))
+
+	// The feed changes when gator saves a post, which can be long after
+	// the post says it was published, so it is dated by the newest save.
+	published := publishedFeed{posts: len(posts)}
+	for _, post := range posts {
+		if post.CreatedAt.After(published.updated) {
+			published.updated = post.CreatedAt
+		}
+	}
+	if published.updated.IsZero() {
+		published.updated = user.UpdatedAt
+	}
+	published.updated = published.updated.UTC().Truncate(time.Second)
+
+	var doc any
+	if *f.kind == "rss" {
+		doc = rssFeedDocument(posts, title, description, *f.url, published.updated)
+	} else {
+		doc = atomFeedDocument(posts, user, feedID, title, description, *f.url, published.updated)
+	}
+	encoded, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return publishedFeed{}, fmt.Errorf("error encoding %s feed: %v", *f.kind, err)
+	}
+	published.body = append([]byte(xml.Header), encoded...)
+	published.body = append(published.body, '\n')
+	return published, nil
+}
+
+func postTime(post database.GetPublishedPostsRow) time.Time {
+	if post.PublishedAt.Valid {
+		return post.PublishedAt.Time
+	}
+	return post.CreatedAt
+}
+
+func atomFeedDocument(posts []database.GetPublishedPostsRow, user database.User, feedID uuid.UUID, title, description, selfURL string, updated time.Time) atomFeed {
+	feed := atomFeed{
+		ID:       "urn:uuid:" + feedID.String(),
+		Title:    title,
+		Subtitle: description,
+		Updated:  updated.Format(time.RFC3339),
+		Author:   atomPerson{Name: user.Name},
+	}
+	if selfURL != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "self", Type: "application/atom+xml", Href: selfURL})
+	} else {
+		feed.Links = append(feed.Links, atomLink{Rel: "alternate", Href: gatorHome})
+	}
+
+	for _, post := range posts {
+		entry := atomEntry{
+			ID:      "urn:uuid:" + post.ID.String(),
+			Title:   post.Title,
+			Updated: postTime(post).UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Rel: "alternate", Href: post.Url}},
+			Source: atomSource{
+				ID:    post.FeedUrl,
+				Title: post.FeedName,
+				Links: []atomLink{{Rel: "self", Href: post.FeedUrl}},
+			},
+		}
+		if post.PublishedAt.Valid {
+			entry.Published = post.PublishedAt.Time.UTC().Format(time.RFC3339)
+		}
+		if post.Author.Valid && post.Author.String != "" {
+			entry.Author = &atomPerson{Name: post.Author.String}
+		}
+		for _, category := range post.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		if post.Description.Valid && post.Description.String != "" {
+			entry.Summary = &atomText{Type: "html", Text: post.Description.String}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func rssFeedDocument(posts []database.GetPublishedPostsRow, title, description, selfURL string, updated time.Time) rssDocument {
+	doc := rssDocument{
+		Version:   "2.0",
+		XMLNSAtom: "http://www.w3.org/2005/Atom",
+		XMLNSDC:   "http://purl.org/dc/elements/1.1/",
+		Channel: publishChannel{
+			Title:         title,
+			Link:          gatorHome,
+			Description:   description,
+			LastBuildDate: updated.Format(time.RFC1123Z),
+			Generator:     "gator",
+		},
+	}
+	if selfURL != "" {
+		doc.Channel.SelfLink = &atomLink{Rel: "self", Type: "application/rss+xml", Href: selfURL}
+	}
+
+	for _, post := range posts {
+		item := publishItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			Description: post.Description.String,
+			Creator:     post.Author.String,
+			Categories:  post.Categories,
+			GUID:        rssGUID{IsPermaLink: "false", Value: "urn:uuid:" + post.ID.String()},
+			PubDate:     postTime(post).UTC().Format(time.RFC1123Z),
+			Source:      rssSource{URL: post.FeedUrl, Title: post.FeedName},
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	return doc
+}
+
+// feedETag is a strong validator for a rendered feed body.
+func feedETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// the weak comparison RFC 9110 asks for.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// feedHandler serves the published feed, rendering it fresh for each
+// request so it follows what the aggregator has collected.
+func feedHandler(s *state, user database.User, f publishFlags) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		published, err := publishFeed(r.Context(), s, user, f)
+		if err != nil {
+			fmt.Println(err)
+			http.Error(w, "error generating feed", http.StatusInternalServerError)
+			return
+		}
+
+		etag := feedETag(published.body)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", published.updated.Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-cache")
+
+		// Only the ETag decides 304s. updated is the newest post still in
+		// the feed, which goes back in time when posts drop out or are
+		// hidden, so If-Modified-Since could miss a change.
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", f.contentType())
+		w.Header().Set("Content-Length", fmt.Sprint(len(published.body)))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(published.body)
+	}
+}
+
+// serveFeed serves the feed at path on addr until the command's context
+// is cancelled.
+func serveFeed(s *state, user database.User, f publishFlags, addr, path string) error {
+	mux := http.NewServeMux()
+	mux.Handle(path, feedHandler(s, user, f))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	fmt.Printf("Serving %s feed for %s at http://%s%s\n", *f.kind, user.Name, addr, path)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("error serving feed: %v", err)
+	case <-s.ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error shutting down feed server: %v", err)
+	}
+	fmt.Println("Feed server stopped")
+	return nil
+}
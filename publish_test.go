@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	etag := feedETag([]byte("<feed/>"))
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{etag, true},
+		{"W/" + etag, true},
+		{`"other", ` + etag, true},
+		{"*", true},
+		{`"other"`, false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.header, etag, got, tt.want)
+		}
+	}
+}
@@ -4,114 +4,377 @@ import (
 	"context"
 	"database/sql"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/d-shames3/gator/internal/database"
+	"github.com/d-shames3/gator/internal/htmltext"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 )
 
-func scrapeFeeds(db *database.Queries) error {
-	feed, err := db.GetNextFeedToFetch(context.Background())
+// fetchLogRetention is how many fetch_log rows are kept per feed.
+const fetchLogRetention = 100
+
+// scrapeFeeds claims the next due feed and saves its posts. The claim locks
+// and marks the feed in one statement, so concurrent agg processes never pick
+// the same feed. Feeds nobody follows are never claimed.
+func scrapeFeeds(s *state) error {
+	err := syncOrphanedFeeds(s)
 	if err != nil {
-		return fmt.Errorf("error getting next feed to fetch: %v", err)
+		return err
 	}
 
-	markedFeed, err := db.MarkFeedFetched(context.Background(), feed.ID)
+	feed, err := s.db.ClaimNextFeedToFetch(s.ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Println("No feeds available to fetch")
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error marking feed as fetched: %v", err)
+		return fmt.Errorf("error claiming next feed to fetch: %v", err)
 	}
 
-	fmt.Printf("Successfully marked feed %s as last fetched %v!\n", markedFeed.Name, markedFeed.LastFetchedAt.Time)
+	fmt.Printf("Successfully marked feed %s as last fetched %v!\n", feed.Name, feed.LastFetchedAt.Time)
+
+	return scrapeFeed(s, feed)
+}
+
+// syncOrphanedFeeds stamps orphaned_at on feeds that just lost their last
+// follower, and clears it on orphaned feeds that have been followed again.
+func syncOrphanedFeeds(s *state) error {
+	orphaned, err := s.db.MarkOrphanedFeeds(s.ctx)
+	if err != nil {
+		return fmt.Errorf("error marking orphaned feeds: %v", err)
+	}
+	if orphaned > 0 {
+		fmt.Printf("Marked %d feeds with no followers as orphaned\n", orphaned)
+	}
+
+	_, err = s.db.UnmarkFollowedFeeds(s.ctx)
+	if err != nil {
+		return fmt.Errorf("error unmarking followed feeds: %v", err)
+	}
+
+	return nil
+}
+
+// scrapeFeed fetches a single feed, saves any new posts, records the attempt
+// in fetch_log and sends notifications about the new posts. Cancelling s.ctx
+// aborts an in-flight request or rolls back the insert, so a feed's posts are
+// saved all together or not at all.
+func scrapeFeed(s *state, feed database.Feed) error {
+	startedAt := time.Now()
+	rssFeed, stats, err := fetchFeed(s.ctx, feed.Url, s.config.MaxFeedSize())
+	var savedPosts []database.Post
+	if err != nil {
+		err = feedError{fmt.Errorf("error fetching RSS feed %s: %v", feed.Name, err)}
+	} else {
+		fmt.Printf("Successfully fetched RSS feed %s!\n", rssFeed.Channel.Title)
+		savedPosts, err = savePosts(s, feed, rssFeed.Channel.Item)
+	}
 
-	rssFeed, err := fetchFeed(context.Background(), feed.Url)
+	logErr := recordFetch(s, feed, startedAt, stats, len(rssFeed.Channel.Item), len(savedPosts), err)
 	if err != nil {
-		return fmt.Errorf("error fetching RSS feed %s: %v", markedFeed.Name, err)
+		return err
+	}
+	if logErr != nil {
+		return logErr
 	}
 
-	fmt.Printf("Successfully fetched RSS feed %s!\n", rssFeed.Channel.Title)
+	return notifyNewPosts(s, feed, savedPosts)
+}
 
-	for _, post := range rssFeed.Channel.Item {
-		validDesc := true
-		if post.Description == "" {
-			validDesc = false
+// feedError is a failure specific to one feed, like a 404 or a response
+// over the size limit. It is already recorded in fetch_log, so agg reports
+// it and moves on instead of stopping.
+type feedError struct {
+	err error
+}
+
+func (e feedError) Error() string {
+	return e.err.Error()
+}
+
+func (e feedError) Unwrap() error {
+	return e.err
+}
+
+// recordFetch writes a fetch_log row and trims the feed's history. It runs
+// even after s.ctx is cancelled, so interrupted attempts are logged too.
+func recordFetch(s *state, feed database.Feed, startedAt time.Time, stats fetchStats, itemsSeen, newPosts int, fetchErr error) error {
+	ctx := context.WithoutCancel(s.ctx)
+	logParams := database.CreateFetchLogParams{
+		ID:         uuid.New(),
+		FeedID:     feed.ID,
+		StartedAt:  startedAt,
+		DurationMs: time.Since(startedAt).Milliseconds(),
+		HttpStatus: sql.NullInt32{Int32: int32(stats.httpStatus), Valid: stats.httpStatus != 0},
+		Bytes:      stats.bytes,
+		ItemsSeen:  int32(itemsSeen),
+		NewPosts:   int32(newPosts),
+	}
+	if fetchErr != nil {
+		logParams.Error = sql.NullString{String: fetchErr.Error(), Valid: true}
+	}
+
+	err := s.db.CreateFetchLog(ctx, logParams)
+	if err != nil {
+		return fmt.Errorf("error recording fetch of %s: %v", feed.Name, err)
+	}
+
+	trimParams := database.TrimFetchLogParams{
+		FeedID: feed.ID,
+		Keep:   fetchLogRetention,
+	}
+	err = s.db.TrimFetchLog(ctx, trimParams)
+	if err != nil {
+		return fmt.Errorf("error trimming fetch log for %s: %v", feed.Name, err)
+	}
+
+	return nil
+}
+
+// pubDateFormats are the layouts tried, in order, when parsing an item's
+// pubDate.
+var pubDateFormats = []string{time.RFC1123, time.RFC1123Z, time.RFC822, time.RFC822Z, time.RFC850, time.RFC3339, time.RFC3339Nano, time.ANSIC, time.UnixDate, time.RubyDate}
+
+func parsePubDate(pubDate string) (time.Time, bool) {
+	for _, timeFormat := range pubDateFormats {
+		publishedAt, err := time.Parse(timeFormat, pubDate)
+		if err == nil {
+			return publishedAt, true
 		}
+	}
+	return time.Time{}, false
+}
 
-		timeFormats := []string{time.RFC1123, time.RFC1123Z, time.RFC822, time.RFC822Z, time.RFC850, time.RFC3339, time.RFC3339Nano, time.ANSIC, time.UnixDate, time.RubyDate}
-		validTime := false
-		var publishedAt time.Time
-		for _, timeFormat := range timeFormats {
-			publishedAt, err = time.Parse(timeFormat, post.PubDate)
-			if err == nil {
-				validTime = true
-				break
-			}
+// savePosts inserts all of the feed's items with a single multi-row insert
+// inside one transaction, skipping urls that are already saved. It returns
+// the posts that were new.
+func savePosts(s *state, feed database.Feed, items []RSSItem) ([]database.Post, error) {
+	createdAt := time.Now().Format(time.RFC3339Nano)
+	postsParams := database.CreatePostsParams{
+		FeedID:       feed.ID,
+		Ids:          make([]uuid.UUID, 0, len(items)),
+		CreatedAts:   make([]string, 0, len(items)),
+		Titles:       make([]string, 0, len(items)),
+		Urls:         make([]string, 0, len(items)),
+		Descriptions: make([]string, 0, len(items)),
+		PublishedAts: make([]string, 0, len(items)),
+		CommentsUrls: make([]string, 0, len(items)),
+		Authors:      make([]string, 0, len(items)),
+		Categories:   make([]string, 0, len(items)),
+	}
+
+	for _, post := range items {
+		publishedAt := ""
+		if parsed, ok := parsePubDate(post.PubDate); ok {
+			publishedAt = parsed.Format(time.RFC3339Nano)
 		}
 
-		postParams := database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-			Title:       post.Title,
-			Url:         post.Link,
-			Description: sql.NullString{String: post.Description, Valid: validDesc},
-			PublishedAt: sql.NullTime{Time: publishedAt, Valid: validTime},
-			FeedID:      feed.ID,
+		postsParams.Ids = append(postsParams.Ids, uuid.New())
+		postsParams.CreatedAts = append(postsParams.CreatedAts, createdAt)
+		postsParams.Titles = append(postsParams.Titles, post.Title)
+		postsParams.Urls = append(postsParams.Urls, post.Link)
+		postsParams.Descriptions = append(postsParams.Descriptions, htmltext.Sanitize(post.Description))
+		postsParams.PublishedAts = append(postsParams.PublishedAts, publishedAt)
+		postsParams.CommentsUrls = append(postsParams.CommentsUrls, post.Comments)
+		postsParams.Authors = append(postsParams.Authors, itemAuthor(post))
+		postsParams.Categories = append(postsParams.Categories, joinCategories(post.Categories))
+	}
+
+	tx, err := s.sqlDB.BeginTx(s.ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction for %s posts: %v", feed.Name, err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.db.WithTx(tx)
+	savedPosts, err := qtx.CreatePosts(s.ctx, postsParams)
+	if err != nil {
+		return nil, fmt.Errorf("error saving posts for %s: %v", feed.Name, err)
+	}
+
+	applied, err := applyIngestRules(s.ctx, qtx, feed, savedPosts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("error committing posts for %s: %v", feed.Name, err)
+	}
+
+	for _, savedPost := range savedPosts {
+		fmt.Printf("Successfully saved post %v in db (link: %v)!\n", savedPost.Title, savedPost.Url)
+	}
+	if applied > 0 {
+		fmt.Printf("Applied %d rule actions to new posts from %s\n", applied, feed.Name)
+	}
+
+	return savedPosts, nil
+}
+
+// itemAuthor prefers the RSS author element and falls back to dc:creator,
+// which is what most feeds actually use.
+func itemAuthor(item RSSItem) string {
+	if item.Author != "" {
+		return htmltext.CleanText(item.Author)
+	}
+	return htmltext.CleanText(item.Creator)
+}
+
+// joinCategories packs an item's categories into one newline separated string
+// so they survive the unnest in CreatePosts, which splits them back apart.
+func joinCategories(categories []string) string {
+	cleaned := make([]string, 0, len(categories))
+	for _, category := range categories {
+		category = htmltext.CleanText(category)
+		if category != "" {
+			cleaned = append(cleaned, category)
 		}
+	}
+	return strings.Join(cleaned, "\n")
+}
 
-		savedPost, err := db.CreatePost(context.Background(), postParams)
-		if err != nil {
-			pqErr, ok := err.(*pq.Error)
-			if !ok {
-				return fmt.Errorf("error parsing sql error: %v", err)
-			}
-			if pqErr.Code == "23505" && pqErr.Table == "posts" && pqErr.Constraint == "posts_url_key" {
-				continue
-			} else {
-				return fmt.Errorf("error code %s from operation on %s table and %s constraint", pqErr.Code, pqErr.Table, pqErr.Constraint)
-			}
+// fetchStats describes the HTTP side of a fetch for the fetch log.
+type fetchStats struct {
+	httpStatus int
+	bytes      int64
+}
+
+var errFeedTooLarge = errors.New("response body exceeds maximum feed size")
+
+// limitedReader behaves like io.LimitReader, except that reading past the
+// limit returns errFeedTooLarge instead of a silent EOF, so a truncated
+// document can't be mistaken for a complete one.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n > 0 {
+			return 0, errFeedTooLarge
 		}
-		fmt.Printf("Successfully saved post %v in db (link: %v)!\n", savedPost.Title, savedPost.Url)
+		return 0, err
 	}
 
-	return nil
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
 }
 
-func fetchFeed(ctx context.Context, feedURL string) (*RSSFeed, error) {
+func fetchFeed(ctx context.Context, feedURL string, maxBytes int64) (*RSSFeed, fetchStats, error) {
+	var stats fetchStats
 	client := http.Client{}
 	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
-		return &RSSFeed{}, fmt.Errorf("error creating fetch RSS feed request: %v", err)
+		return &RSSFeed{}, stats, fmt.Errorf("error creating fetch RSS feed request: %v", err)
 	}
 
 	req.Header.Set("User-Agent", "gator")
 	res, err := client.Do(req)
 	if err != nil {
-		return &RSSFeed{}, fmt.Errorf("error executing RSS feed request: %v", err)
+		return &RSSFeed{}, stats, fmt.Errorf("error executing RSS feed request: %v", err)
 	}
-
 	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return &RSSFeed{}, fmt.Errorf("error reading RSS feed response body: %v", err)
+
+	stats.httpStatus = res.StatusCode
+	if res.StatusCode >= 400 {
+		return &RSSFeed{}, stats, fmt.Errorf("unexpected status fetching RSS feed: %s", res.Status)
+	}
+
+	if res.ContentLength > maxBytes {
+		return &RSSFeed{}, stats, fmt.Errorf("feed %s is %d bytes, over the %d byte limit", feedURL, res.ContentLength, maxBytes)
 	}
 
-	var rss *RSSFeed
-	if err = xml.Unmarshal(body, &rss); err != nil {
-		return &RSSFeed{}, fmt.Errorf("error decoding RSS feed xml: %v", err)
+	body := &limitedReader{r: res.Body, remaining: maxBytes}
+	rss, err := decodeFeed(body)
+	stats.bytes = body.read
+	if errors.Is(err, errFeedTooLarge) {
+		return &RSSFeed{}, stats, fmt.Errorf("feed %s exceeds the %d byte limit, aborting", feedURL, maxBytes)
+	}
+	if err != nil {
+		return &RSSFeed{}, stats, fmt.Errorf("error decoding RSS feed xml: %v", err)
 	}
 
-	rss.Channel.Title = html.UnescapeString(rss.Channel.Title)
-	rss.Channel.Description = html.UnescapeString(rss.Channel.Description)
+	return rss, stats, nil
+}
 
-	for i, item := range rss.Channel.Item {
-		item.Title = html.UnescapeString(item.Title)
-		item.Description = html.UnescapeString(item.Description)
-		rss.Channel.Item[i] = item
+// decodeFeed walks the document token by token, decoding each <item> as soon
+// as it is reached rather than buffering the whole body up front.
+func decodeFeed(r io.Reader) (*RSSFeed, error) {
+	decoder := xml.NewDecoder(r)
+	rss := &RSSFeed{}
+	var path []string
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(path) > 0 {
+				parent = path[len(path)-1]
+			}
+			if parent != "channel" {
+				path = append(path, t.Name.Local)
+				continue
+			}
+
+			switch t.Name.Local {
+			case "item":
+				var item RSSItem
+				if err := decoder.DecodeElement(&item, &t); err != nil {
+					return nil, err
+				}
+				// Titles are plain text, though plenty of feeds escape
+				// them twice. Descriptions are HTML and are sanitized
+				// when saved; unescaping them again would turn escaped
+				// markup in the text into real tags.
+				item.Title = htmltext.CleanText(html.UnescapeString(item.Title))
+				rss.Channel.Item = append(rss.Channel.Item, item)
+			case "title", "link", "description":
+				var text string
+				if err := decoder.DecodeElement(&text, &t); err != nil {
+					return nil, err
+				}
+				text = htmltext.CleanText(html.UnescapeString(text))
+				switch t.Name.Local {
+				case "title":
+					rss.Channel.Title = text
+				case "link":
+					rss.Channel.Link = text
+				case "description":
+					rss.Channel.Description = text
+				}
+			default:
+				path = append(path, t.Name.Local)
+			}
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
 	}
 
 	return rss, nil
@@ -127,8 +390,12 @@ type RSSFeed struct {
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	PubDate     string   `xml:"pubDate"`
+	Comments    string   `xml:"comments"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/d-shames3/gator/internal/config"
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// perRowInsert is the single-row insert savePosts used before it switched
+// to CreatePosts, kept here so the two can be compared.
+const perRowInsert = `INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+// savePostsPerRow saves items one round trip at a time, skipping
+// duplicates by their unique violation, the way savePosts used to.
+func savePostsPerRow(s *state, feed database.Feed, items []RSSItem) error {
+	for _, item := range items {
+		publishedAt, ok := parsePubDate(item.PubDate)
+		now := time.Now()
+		_, err := s.sqlDB.ExecContext(s.ctx, perRowInsert,
+			uuid.New(),
+			now,
+			now,
+			item.Title,
+			item.Link,
+			sql.NullString{String: item.Description, Valid: item.Description != ""},
+			sql.NullTime{Time: publishedAt, Valid: ok},
+			feed.ID,
+		)
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BenchmarkSavePosts compares the multi-row CreatePosts insert with the old
+// per-row insert. It needs a migrated database:
+//
+//	GATOR_TEST_DB_URL=postgres://localhost/gator_test?sslmode=disable go test -run '^$' -bench SavePosts
+func BenchmarkSavePosts(b *testing.B) {
+	dbURL := os.Getenv("GATOR_TEST_DB_URL")
+	if dbURL == "" {
+		b.Skip("GATOR_TEST_DB_URL not set")
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	s := &state{
+		db:     database.New(db),
+		config: &config.Config{},
+		ctx:    context.Background(),
+		sqlDB:  db,
+		format: "table",
+	}
+
+	now := time.Now()
+	user, err := s.db.CreateUser(s.ctx, database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      "bench-" + uuid.NewString(),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Exec("DELETE FROM users WHERE id = $1", user.ID)
+
+	feed, err := s.db.CreateFeed(s.ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      "bench",
+		Url:       "https://bench.example.com/" + uuid.NewString(),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// savePosts reports every saved post on stdout.
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	items := func(n int) []RSSItem {
+		batch := uuid.NewString()
+		items := make([]RSSItem, n)
+		for i := range items {
+			items[i] = RSSItem{
+				Title:       fmt.Sprintf("post %d", i),
+				Link:        fmt.Sprintf("%s/%s/%d", feed.Url, batch, i),
+				Description: "<p>A short description of the post.</p>",
+				PubDate:     now.Format(time.RFC1123Z),
+			}
+		}
+		return items
+	}
+
+	for _, size := range []int{10, 50, 200} {
+		b.Run(fmt.Sprintf("batch/%d", size), func(b *testing.B) {
+			for range b.N {
+				_, err := savePosts(s, feed, items(size))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("per-row/%d", size), func(b *testing.B) {
+			for range b.N {
+				err := savePostsPerRow(s, feed, items(size))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
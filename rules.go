@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+// ruleFields are the post fields a rule can match on, and ruleActions what it
+// can do to a matching post.
+var (
+	ruleFields  = []string{"title", "description", "author", "category"}
+	ruleActions = []string{"hide", "read", "star", "tag"}
+)
+
+// maxRuleCandidates caps how many posts a retroactive rule run looks at.
+const maxRuleCandidates = 100000
+
+// rulePost is the part of a post that rules look at.
+type rulePost struct {
+	id          uuid.UUID
+	shortID     int64
+	feedID      uuid.UUID
+	title       string
+	description string
+	author      string
+	categories  []string
+}
+
+// compiledRule is a rule with its pattern ready to match. Substring rules
+// ignore case; regex rules are used as written, so add (?i) for that.
+type compiledRule struct {
+	database.Rule
+	re *regexp.Regexp
+}
+
+func compileRule(rule database.Rule) (compiledRule, error) {
+	compiled := compiledRule{Rule: rule}
+	switch rule.MatchType {
+	case "contains":
+	case "regex":
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("error compiling pattern %q: %v", rule.Pattern, err)
+		}
+		compiled.re = re
+	default:
+		return compiledRule{}, fmt.Errorf("unknown match type %s", rule.MatchType)
+	}
+	return compiled, nil
+}
+
+func (r compiledRule) matchString(value string) bool {
+	if r.re != nil {
+		return r.re.MatchString(value)
+	}
+	return strings.Contains(strings.ToLower(value), strings.ToLower(r.Pattern))
+}
+
+func (r compiledRule) matches(post rulePost) bool {
+	if r.FeedID.Valid && r.FeedID.UUID != post.feedID {
+		return false
+	}
+
+	switch r.Field {
+	case "title":
+		return r.matchString(post.title)
+	case "description":
+		return r.matchString(post.description)
+	case "author":
+		return r.matchString(post.author)
+	case "category":
+		return slices.ContainsFunc(post.categories, r.matchString)
+	}
+	return false
+}
+
+// apply performs the rule's action on post on behalf of the rule's owner.
+func (r compiledRule) apply(ctx context.Context, db *database.Queries, post rulePost) error {
+	var err error
+	switch r.Action {
+	case "hide":
+		err = db.HidePost(ctx, database.HidePostParams{UserID: r.UserID, PostID: post.id})
+	case "read":
+		err = db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: r.UserID, PostID: post.id})
+	case "star":
+		err = db.StarPost(ctx, database.StarPostParams{UserID: r.UserID, PostID: post.id})
+	case "tag":
+		err = db.TagPost(ctx, database.TagPostParams{UserID: r.UserID, PostID: post.id, Tag: r.Tag.String})
+	default:
+		err = fmt.Errorf("unknown action %s", r.Action)
+	}
+	if err != nil {
+		return fmt.Errorf("error applying rule %d to post %d: %v", r.ShortID, post.shortID, err)
+	}
+	return nil
+}
+
+// applyIngestRules runs the rules of everyone following feed against posts
+// that were just saved for it, and returns how many actions were taken. db
+// is the insert's transaction, so posts and their rule effects are saved
+// together.
+func applyIngestRules(ctx context.Context, db *database.Queries, feed database.Feed, posts []database.Post) (int, error) {
+	if len(posts) == 0 {
+		return 0, nil
+	}
+
+	rules, err := db.GetRulesForFeed(ctx, feed.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching rules for %s: %v", feed.Name, err)
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileRule(rule)
+		if err != nil {
+			return 0, fmt.Errorf("error loading rule %d: %v", rule.ShortID, err)
+		}
+		compiled = append(compiled, c)
+	}
+
+	applied := 0
+	for _, post := range posts {
+		candidate := rulePost{
+			id:          post.ID,
+			shortID:     post.ShortID,
+			feedID:      post.FeedID,
+			title:       post.Title,
+			description: post.Description.String,
+			author:      post.Author.String,
+			categories:  post.Categories,
+		}
+		for _, rule := range compiled {
+			if !rule.matches(candidate) {
+				continue
+			}
+			err := rule.apply(ctx, db, candidate)
+			if err != nil {
+				return applied, err
+			}
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// ruleCandidates returns every post in the user's followed feeds, newest
+// first, narrowed to one feed when feedID is set.
+func ruleCandidates(s *state, user database.User, feedID uuid.NullUUID) ([]rulePost, error) {
+	rows, err := s.db.GetRuleCandidates(s.ctx, database.GetRuleCandidatesParams{
+		UserID:   user.ID,
+		FeedID:   feedID,
+		RowLimit: maxRuleCandidates,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching posts for user %s: %v", user.Name, err)
+	}
+
+	posts := make([]rulePost, 0, len(rows))
+	for _, row := range rows {
+		posts = append(posts, rulePost{
+			id:          row.ID,
+			shortID:     row.ShortID,
+			feedID:      row.FeedID,
+			title:       row.Title,
+			description: row.Description.String,
+			author:      row.Author.String,
+			categories:  row.Categories,
+		})
+	}
+	return posts, nil
+}
+
+// ruleFlags are the flags shared by rule add and rule test.
+type ruleFlags struct {
+	feed   *string
+	field  *string
+	regex  *bool
+	action *string
+	tag    *string
+}
+
+func addRuleFlags(fs *flag.FlagSet) ruleFlags {
+	return ruleFlags{
+		feed:   fs.String("feed", "", "only apply to posts from this feed (url, name or alias)"),
+		field:  fs.String("field", "title", "post field to match: "+strings.Join(ruleFields, ", ")),
+		regex:  fs.Bool("regex", false, "treat the pattern as a regular expression instead of a substring"),
+		action: fs.String("action", "hide", "what to do with matching posts: "+strings.Join(ruleActions, ", ")),
+		tag:    fs.String("tag", "", "tag to add when --action is tag"),
+	}
+}
+
+// rule validates the parsed flags and the pattern argument and builds an
+// unsaved rule for user from them.
+func (f ruleFlags) rule(s *state, user database.User, fs *flag.FlagSet) (database.CreateRuleParams, error) {
+	if fs.NArg() == 0 {
+		return database.CreateRuleParams{}, fmt.Errorf("must provide a pattern to match")
+	}
+	if !slices.Contains(ruleFields, *f.field) {
+		return database.CreateRuleParams{}, fmt.Errorf("--field must be one of %s", strings.Join(ruleFields, ", "))
+	}
+	if !slices.Contains(ruleActions, *f.action) {
+		return database.CreateRuleParams{}, fmt.Errorf("--action must be one of %s", strings.Join(ruleActions, ", "))
+	}
+	if (*f.action == "tag") != (*f.tag != "") {
+		return database.CreateRuleParams{}, fmt.Errorf("--tag is required with --action tag, and only allowed with it")
+	}
+
+	params := database.CreateRuleParams{
+		UserID:    user.ID,
+		Field:     *f.field,
+		MatchType: "contains",
+		Pattern:   strings.Join(fs.Args(), " "),
+		Action:    *f.action,
+	}
+	if *f.regex {
+		params.MatchType = "regex"
+	}
+	if *f.tag != "" {
+		params.Tag.String = *f.tag
+		params.Tag.Valid = true
+	}
+	if *f.feed != "" {
+		feed, err := getUserFeed(s, user, *f.feed)
+		if err != nil {
+			return database.CreateRuleParams{}, err
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+
+	_, err := compileRule(database.Rule{MatchType: params.MatchType, Pattern: params.Pattern})
+	if err != nil {
+		return database.CreateRuleParams{}, err
+	}
+
+	return params, nil
+}
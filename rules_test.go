@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestCompileRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		matchType string
+		pattern   string
+		wantErr   bool
+	}{
+		{"substring", "contains", "golang", false},
+		{"substring with regex syntax", "contains", "c++ (", false},
+		{"regex", "regex", `^v\d+\.\d+`, false},
+		{"invalid regex", "regex", "go(lang", true},
+		{"unknown match type", "glob", "go*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileRule(database.Rule{MatchType: tt.matchType, Pattern: tt.pattern})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("compileRule(%s %q) error = %v, want error %v", tt.matchType, tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	feedID := uuid.New()
+	post := rulePost{
+		feedID:      feedID,
+		title:       "Announcing Go 1.23",
+		description: "<p>Range over func iterators are here.</p>",
+		author:      "The Go Team",
+		categories:  []string{"Release", "golang"},
+	}
+
+	tests := []struct {
+		name      string
+		field     string
+		matchType string
+		pattern   string
+		feedID    uuid.NullUUID
+		want      bool
+	}{
+		{"title substring", "title", "contains", "go 1.23", uuid.NullUUID{}, true},
+		{"title substring ignores case", "title", "contains", "ANNOUNCING", uuid.NullUUID{}, true},
+		{"title substring miss", "title", "contains", "rust", uuid.NullUUID{}, false},
+		{"substring treats regex syntax literally", "title", "contains", "go 1.2.", uuid.NullUUID{}, false},
+		{"title regex", "title", "regex", `Go 1\.\d+$`, uuid.NullUUID{}, true},
+		{"regex is case sensitive", "title", "regex", "announcing", uuid.NullUUID{}, false},
+		{"regex with case folding flag", "title", "regex", "(?i)announcing", uuid.NullUUID{}, true},
+		{"description", "description", "contains", "iterators", uuid.NullUUID{}, true},
+		{"description miss", "description", "contains", "generics", uuid.NullUUID{}, false},
+		{"author", "author", "contains", "go team", uuid.NullUUID{}, true},
+		{"author regex", "author", "regex", "^Team", uuid.NullUUID{}, false},
+		{"category", "category", "contains", "release", uuid.NullUUID{}, true},
+		{"category regex matches any category", "category", "regex", "^go", uuid.NullUUID{}, true},
+		{"category miss", "category", "contains", "security", uuid.NullUUID{}, false},
+		{"unknown field", "url", "contains", "go", uuid.NullUUID{}, false},
+		{"same feed", "title", "contains", "go", uuid.NullUUID{UUID: feedID, Valid: true}, true},
+		{"other feed", "title", "contains", "go", uuid.NullUUID{UUID: uuid.New(), Valid: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compileRule(database.Rule{
+				Field:     tt.field,
+				MatchType: tt.matchType,
+				Pattern:   tt.pattern,
+				FeedID:    tt.feedID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.matches(post); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -29,16 +29,53 @@ INNER JOIN feeds
 
 SELECT
     feed_follows.id,
+    feed_follows.feed_id,
     users.name as user,
-    feeds.name as feed
+    COALESCE(feed_follows.alias, feeds.name) as feed,
+    feeds.url,
+    feed_follows.folder,
+    (
+        SELECT count(*)
+        FROM posts
+        LEFT JOIN post_states
+            ON posts.id = post_states.post_id
+            AND post_states.user_id = feed_follows.user_id
+        WHERE posts.feed_id = feed_follows.feed_id
+        AND post_states.read_at IS NULL
+        AND post_states.hidden_at IS NULL
+    ) as unread
 FROM feed_follows
 INNER JOIN users
     ON feed_follows.user_id = users.id
 INNER JOIN feeds
     ON feed_follows.feed_id = feeds.id
 WHERE feed_follows.user_id = $1
+ORDER BY feed_follows.folder NULLS LAST, COALESCE(feed_follows.alias, feeds.name)
 ;
 
 -- name: DeleteFeedFollowForUser :exec
 DELETE FROM feed_follows
 WHERE user_id = $1 and feed_id = $2;
+
+-- name: SetFeedFollowFolder :execrows
+UPDATE feed_follows
+SET updated_at = CURRENT_TIMESTAMP, folder = $3
+WHERE user_id = $1 AND feed_id = $2;
+
+-- name: SetFeedFollowAlias :execrows
+UPDATE feed_follows
+SET updated_at = CURRENT_TIMESTAMP, alias = $3
+WHERE user_id = $1 AND feed_id = $2;
+
+-- name: GetFollowsForExport :many
+SELECT
+    feeds.url,
+    feeds.name,
+    feed_follows.folder,
+    feed_follows.alias,
+    feed_follows.created_at
+FROM feed_follows
+INNER JOIN feeds
+    ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feed_follows.created_at;
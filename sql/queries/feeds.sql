@@ -30,8 +30,117 @@ WHERE url = $1 LIMIT 1;
  WHERE id = $1
  RETURNING *;
 
--- name: GetNextFeedToFetch :one
-SELECT url, id
-FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
+-- name: ClaimNextFeedToFetch :one
+UPDATE feeds
+SET updated_at = CURRENT_TIMESTAMP, last_fetched_at = CURRENT_TIMESTAMP
+WHERE id = (
+    SELECT id
+    FROM feeds
+    WHERE EXISTS (
+        SELECT 1 FROM feed_follows
+        WHERE feed_follows.feed_id = feeds.id
+    )
+    ORDER BY last_fetched_at NULLS FIRST
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetFeedByURLOrName :one
+SELECT * FROM feeds
+WHERE url = sqlc.arg(feed) OR name = sqlc.arg(feed)
+ORDER BY url = sqlc.arg(feed) DESC
+LIMIT 1;
+
+-- name: GetFeedForUser :one
+SELECT feeds.* FROM feeds
+LEFT JOIN feed_follows
+    ON feeds.id = feed_follows.feed_id
+    AND feed_follows.user_id = sqlc.arg(user_id)
+WHERE feed_follows.alias = sqlc.arg(feed) OR feeds.url = sqlc.arg(feed) OR feeds.name = sqlc.arg(feed)
+ORDER BY
+    (feed_follows.alias = sqlc.arg(feed)) IS TRUE DESC,
+    feeds.url = sqlc.arg(feed) DESC,
+    feed_follows.id IS NOT NULL DESC
 LIMIT 1;
+
+-- name: GetFollowedFeeds :many
+SELECT * FROM feeds
+WHERE EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+ORDER BY last_fetched_at NULLS FIRST;
+
+-- name: MarkOrphanedFeeds :execrows
+UPDATE feeds
+SET orphaned_at = CURRENT_TIMESTAMP
+WHERE orphaned_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+);
+
+-- name: MarkFeedOrphaned :exec
+UPDATE feeds
+SET orphaned_at = CURRENT_TIMESTAMP
+WHERE id = $1
+AND orphaned_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+);
+
+-- name: UnmarkFollowedFeeds :execrows
+UPDATE feeds
+SET orphaned_at = NULL
+WHERE orphaned_at IS NOT NULL
+AND EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+);
+
+-- name: GetOrphanedFeeds :many
+SELECT
+    name,
+    url,
+    orphaned_at,
+    (
+        SELECT count(*)
+        FROM posts
+        INNER JOIN post_states
+            ON posts.id = post_states.post_id
+        WHERE posts.feed_id = feeds.id
+        AND post_states.starred_at IS NOT NULL
+    ) as starred_posts
+FROM feeds
+WHERE orphaned_at < CURRENT_TIMESTAMP - make_interval(secs => sqlc.arg(grace_seconds)::float8)
+ORDER BY orphaned_at;
+
+-- name: DeleteOrphanedPosts :execrows
+DELETE FROM posts
+USING feeds
+WHERE posts.feed_id = feeds.id
+AND feeds.orphaned_at < CURRENT_TIMESTAMP - make_interval(secs => sqlc.arg(grace_seconds)::float8)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE post_states.post_id = posts.id
+    AND post_states.starred_at IS NOT NULL
+);
+
+-- name: DeleteOrphanedFeeds :many
+DELETE FROM feeds
+WHERE orphaned_at < CURRENT_TIMESTAMP - make_interval(secs => sqlc.arg(grace_seconds)::float8)
+AND NOT EXISTS (
+    SELECT 1 FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM posts
+    WHERE posts.feed_id = feeds.id
+)
+RETURNING name, url;
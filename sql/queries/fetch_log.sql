@@ -0,0 +1,42 @@
+-- name: CreateFetchLog :exec
+INSERT INTO fetch_log (id, feed_id, started_at, duration_ms, http_status, bytes, items_seen, new_posts, error)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+);
+
+-- name: GetFetchLog :many
+SELECT
+    fetch_log.id,
+    feeds.name as feed,
+    fetch_log.started_at,
+    fetch_log.duration_ms,
+    fetch_log.http_status,
+    fetch_log.bytes,
+    fetch_log.items_seen,
+    fetch_log.new_posts,
+    fetch_log.error
+FROM fetch_log
+INNER JOIN feeds
+    ON fetch_log.feed_id = feeds.id
+WHERE sqlc.narg(feed_id)::uuid IS NULL OR fetch_log.feed_id = sqlc.narg(feed_id)
+ORDER BY fetch_log.started_at DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: TrimFetchLog :exec
+DELETE FROM fetch_log
+WHERE fetch_log.feed_id = sqlc.arg(feed_id)
+AND fetch_log.id NOT IN (
+    SELECT recent.id
+    FROM fetch_log AS recent
+    WHERE recent.feed_id = sqlc.arg(feed_id)
+    ORDER BY recent.started_at DESC
+    LIMIT sqlc.arg(keep)
+);
@@ -0,0 +1,11 @@
+-- name: TryAdvisoryLock :one
+SELECT pg_try_advisory_lock(sqlc.arg(lock_id)::bigint);
+
+-- name: TryAdvisoryLockShared :one
+SELECT pg_try_advisory_lock_shared(sqlc.arg(lock_id)::bigint);
+
+-- name: AdvisoryUnlock :exec
+SELECT pg_advisory_unlock(sqlc.arg(lock_id)::bigint);
+
+-- name: AdvisoryUnlockShared :exec
+SELECT pg_advisory_unlock_shared(sqlc.arg(lock_id)::bigint);
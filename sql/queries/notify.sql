@@ -0,0 +1,80 @@
+-- name: CreateNotifySink :one
+INSERT INTO notify_sinks (id, created_at, updated_at, user_id, kind, target, keyword)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: GetNotifySinksForUser :many
+SELECT * FROM notify_sinks
+WHERE user_id = $1
+ORDER BY short_id;
+
+-- name: GetNotifySinkByShortID :one
+SELECT * FROM notify_sinks
+WHERE user_id = $1 AND short_id = $2;
+
+-- name: DeleteNotifySink :execrows
+DELETE FROM notify_sinks
+WHERE user_id = $1 AND short_id = $2;
+
+-- name: GetNotifySinksForFeed :many
+SELECT
+    notify_sinks.*,
+    users.name as user_name,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name
+FROM notify_sinks
+INNER JOIN users
+    ON notify_sinks.user_id = users.id
+INNER JOIN feed_follows
+    ON notify_sinks.user_id = feed_follows.user_id
+INNER JOIN feeds
+    ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.feed_id = $1
+ORDER BY notify_sinks.short_id;
+
+-- name: CreateNotifyLog :exec
+INSERT INTO notify_log (id, sink_id, post_id, attempted_at, attempts, error)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: GetNotifyLog :many
+SELECT
+    notify_log.id,
+    notify_sinks.short_id as sink_id,
+    notify_sinks.kind,
+    posts.title as post_title,
+    notify_log.attempted_at,
+    notify_log.attempts,
+    notify_log.error
+FROM notify_log
+INNER JOIN notify_sinks
+    ON notify_log.sink_id = notify_sinks.id
+LEFT JOIN posts
+    ON notify_log.post_id = posts.id
+WHERE notify_sinks.user_id = sqlc.arg(user_id)
+ORDER BY notify_log.attempted_at DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: TrimNotifyLog :exec
+DELETE FROM notify_log
+WHERE notify_log.sink_id = sqlc.arg(sink_id)
+AND notify_log.id NOT IN (
+    SELECT recent.id
+    FROM notify_log AS recent
+    WHERE recent.sink_id = sqlc.arg(sink_id)
+    ORDER BY recent.attempted_at DESC
+    LIMIT sqlc.arg(keep)
+);
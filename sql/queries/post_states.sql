@@ -0,0 +1,203 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, read_at)
+VALUES (
+    $1,
+    $2,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = CURRENT_TIMESTAMP, read_at = COALESCE(post_states.read_at, CURRENT_TIMESTAMP);
+
+-- name: MarkPostUnread :exec
+UPDATE post_states
+SET updated_at = CURRENT_TIMESTAMP, read_at = NULL
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: MarkPostsRead :execrows
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, read_at)
+SELECT
+    feed_follows.user_id,
+    posts.id,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP
+FROM posts
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(before)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(before))
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = CURRENT_TIMESTAMP, read_at = CURRENT_TIMESTAMP
+WHERE post_states.read_at IS NULL;
+
+-- name: StarPost :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, starred_at)
+VALUES (
+    $1,
+    $2,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = CURRENT_TIMESTAMP, starred_at = COALESCE(post_states.starred_at, CURRENT_TIMESTAMP);
+
+-- name: UnstarPost :exec
+UPDATE post_states
+SET updated_at = CURRENT_TIMESTAMP, starred_at = NULL
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: QueuePost :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, queued_at, snoozed_until)
+VALUES (
+    $1,
+    $2,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    $3
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = CURRENT_TIMESTAMP,
+    queued_at = COALESCE(post_states.queued_at, CURRENT_TIMESTAMP),
+    snoozed_until = EXCLUDED.snoozed_until;
+
+-- name: UnqueuePost :exec
+UPDATE post_states
+SET updated_at = CURRENT_TIMESTAMP, queued_at = NULL, snoozed_until = NULL
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetStarredPosts :many
+SELECT
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    posts.title as post_title,
+    posts.url,
+    posts.published_at,
+    post_states.starred_at
+FROM post_states
+INNER JOIN posts
+    ON post_states.post_id = posts.id
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+LEFT JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+    AND feed_follows.user_id = post_states.user_id
+WHERE post_states.user_id = $1
+AND post_states.starred_at IS NOT NULL
+ORDER BY post_states.starred_at DESC;
+
+-- name: GetQueuedPosts :many
+SELECT
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    posts.title as post_title,
+    posts.url,
+    posts.published_at,
+    post_states.queued_at,
+    post_states.snoozed_until
+FROM post_states
+INNER JOIN posts
+    ON post_states.post_id = posts.id
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+LEFT JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+    AND feed_follows.user_id = post_states.user_id
+WHERE post_states.user_id = sqlc.arg(user_id)
+AND post_states.queued_at IS NOT NULL
+AND (
+    sqlc.arg(include_snoozed)::bool
+    OR post_states.snoozed_until IS NULL
+    OR post_states.snoozed_until <= CURRENT_TIMESTAMP
+)
+ORDER BY COALESCE(post_states.snoozed_until, post_states.queued_at);
+
+-- name: HidePost :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, hidden_at)
+VALUES (
+    $1,
+    $2,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = CURRENT_TIMESTAMP, hidden_at = COALESCE(post_states.hidden_at, CURRENT_TIMESTAMP);
+
+-- name: TagPost :exec
+INSERT INTO post_tags (user_id, post_id, tag, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    CURRENT_TIMESTAMP
+)
+ON CONFLICT (user_id, post_id, tag) DO NOTHING;
+
+-- name: IsPostHidden :one
+SELECT EXISTS (
+    SELECT 1 FROM post_states
+    WHERE user_id = $1 AND post_id = $2 AND hidden_at IS NOT NULL
+);
+
+-- name: ImportPostState :exec
+INSERT INTO post_states (user_id, post_id, created_at, updated_at, read_at, starred_at, queued_at, snoozed_until, hidden_at)
+VALUES (
+    sqlc.arg(user_id),
+    sqlc.arg(post_id),
+    CURRENT_TIMESTAMP,
+    CURRENT_TIMESTAMP,
+    sqlc.narg(read_at),
+    sqlc.narg(starred_at),
+    sqlc.narg(queued_at),
+    sqlc.narg(snoozed_until),
+    sqlc.narg(hidden_at)
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET updated_at = CURRENT_TIMESTAMP,
+    read_at = COALESCE(post_states.read_at, EXCLUDED.read_at),
+    starred_at = COALESCE(post_states.starred_at, EXCLUDED.starred_at),
+    queued_at = COALESCE(post_states.queued_at, EXCLUDED.queued_at),
+    snoozed_until = COALESCE(post_states.snoozed_until, EXCLUDED.snoozed_until),
+    hidden_at = COALESCE(post_states.hidden_at, EXCLUDED.hidden_at);
+
+-- name: GetPostStatesForExport :many
+SELECT
+    posts.url,
+    posts.title,
+    posts.description,
+    posts.published_at,
+    posts.comments_url,
+    posts.author,
+    posts.categories,
+    feeds.url as feed_url,
+    feeds.name as feed_name,
+    post_states.read_at,
+    post_states.starred_at,
+    post_states.queued_at,
+    post_states.snoozed_until,
+    post_states.hidden_at,
+    ARRAY(
+        SELECT post_tags.tag
+        FROM post_tags
+        WHERE post_tags.post_id = posts.id
+        AND post_tags.user_id = sqlc.arg(user_id)
+        ORDER BY post_tags.tag
+    )::text[] as tags
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = sqlc.arg(user_id)
+WHERE post_states.user_id IS NOT NULL
+OR EXISTS (
+    SELECT 1 FROM post_tags
+    WHERE post_tags.post_id = posts.id
+    AND post_tags.user_id = sqlc.arg(user_id)
+)
+ORDER BY COALESCE(posts.published_at, posts.created_at);
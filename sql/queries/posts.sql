@@ -1,31 +1,168 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-    $1,
-    $2,
-    $3,
-    $4,
-    $5,
-    $6,
-    $7,
-    $8
-) 
+-- name: CreatePosts :many
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, comments_url, author, categories)
+SELECT
+    new_posts.id,
+    new_posts.created_at::timestamp,
+    new_posts.created_at::timestamp,
+    new_posts.title,
+    new_posts.url,
+    NULLIF(new_posts.description, ''),
+    NULLIF(new_posts.published_at, '')::timestamp,
+    sqlc.arg(feed_id)::uuid,
+    NULLIF(new_posts.comments_url, ''),
+    NULLIF(new_posts.author, ''),
+    string_to_array(new_posts.categories, E'\n')
+FROM (
+    SELECT
+        unnest(sqlc.arg(ids)::uuid[]) AS id,
+        unnest(sqlc.arg(created_ats)::text[]) AS created_at,
+        unnest(sqlc.arg(titles)::text[]) AS title,
+        unnest(sqlc.arg(urls)::text[]) AS url,
+        unnest(sqlc.arg(descriptions)::text[]) AS description,
+        unnest(sqlc.arg(published_ats)::text[]) AS published_at,
+        unnest(sqlc.arg(comments_urls)::text[]) AS comments_url,
+        unnest(sqlc.arg(authors)::text[]) AS author,
+        unnest(sqlc.arg(categories)::text[]) AS categories
+) AS new_posts
+ON CONFLICT (url) DO NOTHING
 RETURNING *;
 
+-- name: GetPostByShortID :one
+SELECT posts.* FROM posts
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+WHERE posts.short_id = $1
+AND feed_follows.user_id = $2;
+
 -- name: GetPostsForUser :many
 SELECT 
-    feeds.name as feed_name,
+    posts.id,
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
     posts.url,
     posts.title as post_title,
     posts.description,
     posts.created_at,
     posts.updated_at,
+    posts.published_at,
+    post_states.read_at,
+    post_states.starred_at,
+    ARRAY(
+        SELECT post_tags.tag
+        FROM post_tags
+        WHERE post_tags.post_id = posts.id
+        AND post_tags.user_id = feed_follows.user_id
+        ORDER BY post_tags.tag
+    )::text[] as tags
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND post_states.hidden_at IS NULL
+AND (NOT sqlc.arg(unread_only)::bool OR post_states.read_at IS NULL)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) < sqlc.narg(until))
+AND (sqlc.narg(folder)::text IS NULL OR feed_follows.folder = sqlc.narg(folder))
+AND (
+    sqlc.narg(after_id)::bigint IS NULL
+    OR (
+        CASE WHEN sqlc.arg(sort_by)::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END,
+        posts.short_id
+    ) < (
+        SELECT
+            CASE WHEN sqlc.arg(sort_by)::text = 'fetched' THEN cursor_post.created_at ELSE COALESCE(cursor_post.published_at, cursor_post.created_at) END,
+            cursor_post.short_id
+        FROM posts AS cursor_post
+        WHERE cursor_post.short_id = sqlc.narg(after_id)
+    )
+)
+ORDER BY
+    CASE WHEN sqlc.arg(sort_by)::text = 'fetched' THEN posts.created_at ELSE COALESCE(posts.published_at, posts.created_at) END DESC,
+    posts.short_id DESC
+OFFSET sqlc.arg(row_offset)
+LIMIT sqlc.arg(row_limit);
+
+-- name: SearchPosts :many
+SELECT
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    posts.title as post_title,
+    posts.url,
+    posts.published_at,
+    ts_rank(posts.search, search_query) as rank
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+CROSS JOIN websearch_to_tsquery('english', sqlc.arg(query)) AS search_query
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND posts.search @@ search_query
+AND post_states.hidden_at IS NULL
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(since)::timestamp IS NULL OR COALESCE(posts.published_at, posts.created_at) >= sqlc.narg(since))
+ORDER BY rank DESC, COALESCE(posts.published_at, posts.created_at) DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetDigestPosts :many
+SELECT
+    posts.short_id,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    posts.title as post_title,
+    posts.url,
     posts.published_at
 FROM posts
 INNER JOIN feeds
     ON posts.feed_id = feeds.id
 INNER JOIN feed_follows
     ON posts.feed_id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.created_at DESC
-LIMIT $2;
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND posts.created_at > sqlc.arg(since)
+AND posts.created_at <= sqlc.arg(until)
+AND post_states.hidden_at IS NULL
+ORDER BY feed_name, COALESCE(posts.published_at, posts.created_at) DESC
+LIMIT sqlc.arg(row_limit);
+
+-- name: GetPostIDsByURL :many
+SELECT id, url, feed_id FROM posts
+WHERE url = ANY(sqlc.arg(urls)::text[])
+AND feed_id = ANY(sqlc.arg(feed_ids)::uuid[]);
+
+-- name: GetPublishedPosts :many
+SELECT
+    posts.id,
+    posts.url,
+    posts.title,
+    posts.description,
+    posts.author,
+    posts.categories,
+    posts.published_at,
+    posts.created_at,
+    COALESCE(feed_follows.alias, feeds.name) as feed_name,
+    feeds.url as feed_url
+FROM posts
+INNER JOIN feeds
+    ON posts.feed_id = feeds.id
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN post_states
+    ON posts.id = post_states.post_id
+    AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND post_states.hidden_at IS NULL
+AND (sqlc.narg(folder)::text IS NULL OR feed_follows.folder = sqlc.narg(folder))
+AND (sqlc.narg(query)::text IS NULL OR posts.search @@ websearch_to_tsquery('english', sqlc.narg(query)))
+ORDER BY COALESCE(posts.published_at, posts.created_at) DESC, posts.short_id DESC
+LIMIT sqlc.arg(row_limit);
@@ -0,0 +1,55 @@
+-- name: CreateRule :one
+INSERT INTO rules (id, created_at, updated_at, user_id, feed_id, field, match_type, pattern, action, tag)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10
+)
+RETURNING *;
+
+-- name: GetRulesForUser :many
+SELECT rules.*, feeds.name as feed, feeds.url as feed_url FROM rules
+LEFT JOIN feeds
+    ON rules.feed_id = feeds.id
+WHERE rules.user_id = $1
+ORDER BY rules.short_id;
+
+-- name: GetRuleByShortID :one
+SELECT * FROM rules
+WHERE user_id = $1 AND short_id = $2;
+
+-- name: DeleteRule :execrows
+DELETE FROM rules
+WHERE user_id = $1 AND short_id = $2;
+
+-- name: GetRulesForFeed :many
+SELECT rules.* FROM rules
+INNER JOIN feed_follows
+    ON rules.user_id = feed_follows.user_id
+WHERE feed_follows.feed_id = sqlc.arg(feed_id)
+AND (rules.feed_id IS NULL OR rules.feed_id = sqlc.arg(feed_id))
+ORDER BY rules.short_id;
+
+-- name: GetRuleCandidates :many
+SELECT
+    posts.id,
+    posts.short_id,
+    posts.feed_id,
+    posts.title,
+    posts.description,
+    posts.author,
+    posts.categories
+FROM posts
+INNER JOIN feed_follows
+    ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+ORDER BY posts.created_at DESC
+LIMIT sqlc.arg(row_limit);
@@ -17,3 +17,23 @@ SELECT name FROM users;
 
 -- name: DeleteUsers :exec
 DELETE FROM users;
+
+-- name: SetUserDigest :exec
+UPDATE users
+SET updated_at = CURRENT_TIMESTAMP, email = $2, digest_frequency = $3
+WHERE id = $1;
+
+-- name: GetDueDigestUsers :many
+SELECT * FROM users
+WHERE email IS NOT NULL
+AND digest_frequency IS NOT NULL
+AND (
+    last_digest_at IS NULL
+    OR last_digest_at <= sqlc.arg(now)::timestamp - CASE WHEN digest_frequency = 'weekly' THEN INTERVAL '7 days' ELSE INTERVAL '1 day' END
+)
+ORDER BY name;
+
+-- name: MarkDigestSent :exec
+UPDATE users
+SET last_digest_at = $2
+WHERE id = $1;
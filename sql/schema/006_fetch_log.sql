@@ -0,0 +1,17 @@
+-- +goose up
+CREATE TABLE fetch_log (
+    id UUID PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    http_status INTEGER,
+    bytes BIGINT NOT NULL,
+    items_seen INTEGER NOT NULL,
+    new_posts INTEGER NOT NULL,
+    error VARCHAR
+);
+
+CREATE INDEX fetch_log_feed_id_started_at_idx ON fetch_log (feed_id, started_at DESC);
+
+-- +goose down
+DROP TABLE fetch_log;
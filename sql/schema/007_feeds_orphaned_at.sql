@@ -0,0 +1,7 @@
+-- +goose up
+ALTER TABLE feeds
+ADD COLUMN orphaned_at TIMESTAMP;
+
+-- +goose down
+ALTER TABLE feeds
+DROP COLUMN orphaned_at;
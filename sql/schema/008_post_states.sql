@@ -0,0 +1,18 @@
+-- +goose up
+ALTER TABLE posts
+ADD COLUMN short_id BIGSERIAL UNIQUE;
+
+CREATE TABLE post_states (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- +goose down
+DROP TABLE post_states;
+
+ALTER TABLE posts
+DROP COLUMN short_id;
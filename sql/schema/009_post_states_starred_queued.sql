@@ -0,0 +1,11 @@
+-- +goose up
+ALTER TABLE post_states
+ADD COLUMN starred_at TIMESTAMP,
+ADD COLUMN queued_at TIMESTAMP,
+ADD COLUMN snoozed_until TIMESTAMP;
+
+-- +goose down
+ALTER TABLE post_states
+DROP COLUMN starred_at,
+DROP COLUMN queued_at,
+DROP COLUMN snoozed_until;
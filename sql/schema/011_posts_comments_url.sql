@@ -0,0 +1,7 @@
+-- +goose up
+ALTER TABLE posts
+ADD COLUMN comments_url VARCHAR;
+
+-- +goose down
+ALTER TABLE posts
+DROP COLUMN comments_url;
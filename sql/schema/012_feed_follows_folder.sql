@@ -0,0 +1,7 @@
+-- +goose up
+ALTER TABLE feed_follows
+ADD COLUMN folder VARCHAR;
+
+-- +goose down
+ALTER TABLE feed_follows
+DROP COLUMN folder;
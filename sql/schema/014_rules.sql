@@ -0,0 +1,41 @@
+-- +goose up
+ALTER TABLE posts
+ADD COLUMN author VARCHAR,
+ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE post_states
+ADD COLUMN hidden_at TIMESTAMP;
+
+CREATE TABLE post_tags (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    tag VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id, tag)
+);
+
+CREATE TABLE rules (
+    id UUID PRIMARY KEY,
+    short_id BIGSERIAL UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    field VARCHAR NOT NULL,
+    match_type VARCHAR NOT NULL,
+    pattern VARCHAR NOT NULL,
+    action VARCHAR NOT NULL,
+    tag VARCHAR
+);
+
+-- +goose down
+DROP TABLE rules;
+
+DROP TABLE post_tags;
+
+ALTER TABLE post_states
+DROP COLUMN hidden_at;
+
+ALTER TABLE posts
+DROP COLUMN author,
+DROP COLUMN categories;
@@ -0,0 +1,27 @@
+-- +goose up
+CREATE TABLE notify_sinks (
+    id UUID PRIMARY KEY,
+    short_id BIGSERIAL UNIQUE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR NOT NULL,
+    target VARCHAR NOT NULL,
+    keyword VARCHAR
+);
+
+CREATE TABLE notify_log (
+    id UUID PRIMARY KEY,
+    sink_id UUID NOT NULL REFERENCES notify_sinks(id) ON DELETE CASCADE,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    attempted_at TIMESTAMP NOT NULL,
+    attempts INT NOT NULL,
+    error VARCHAR
+);
+
+CREATE INDEX notify_log_sink_id_attempted_at_idx ON notify_log (sink_id, attempted_at DESC);
+
+-- +goose down
+DROP TABLE notify_log;
+
+DROP TABLE notify_sinks;
@@ -0,0 +1,11 @@
+-- +goose up
+ALTER TABLE users
+ADD COLUMN email VARCHAR,
+ADD COLUMN digest_frequency VARCHAR,
+ADD COLUMN last_digest_at TIMESTAMP;
+
+-- +goose down
+ALTER TABLE users
+DROP COLUMN email,
+DROP COLUMN digest_frequency,
+DROP COLUMN last_digest_at;
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+// builtinTemplates are the named layouts --template accepts in place of
+// template text. They use the columns shared by the post listings in
+// builtinTemplateCommands, so they can't be used with other commands.
+var builtinTemplates = map[string]string{
+	"compact":  `{{printf "%5v" .id}}  {{color "cyan" (truncate 20 .feed)}}  {{.title}}`,
+	"titles":   `[{{.feed}}] {{.title}} — {{.url}}`,
+	"detailed": "{{bold .title}}\n  {{color \"cyan\" .feed}}{{with .published_at}} · {{ago .}}{{end}}{{with .status}} · {{.}}{{end}}\n  {{color \"blue\" .url}}\n",
+	"markdown": `- [{{.title}}]({{.url}}) ({{.feed}})`,
+}
+
+var builtinTemplateCommands = []string{"browse", "search", "starred", "queue"}
+
+// ansiColors are the names the color template function understands.
+var ansiColors = map[string]string{
+	"bold":    "1",
+	"dim":     "2",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"gray":    "90",
+}
+
+// parseOutputTemplate parses a built-in template name or template text for
+// command's listing. Each listing row is passed to it as a map keyed by
+// column name, so a browse template can use {{.title}}, {{.url}} and so on.
+func parseOutputTemplate(text, command string) (*template.Template, error) {
+	if builtin, ok := builtinTemplates[text]; ok {
+		if !slices.Contains(builtinTemplateCommands, command) {
+			return nil, fmt.Errorf("built-in template %s only works with %s", text, strings.Join(builtinTemplateCommands, ", "))
+		}
+		text = builtin
+	}
+
+	useColor := colorEnabled()
+	funcs := template.FuncMap{
+		"ago":      relativeTime,
+		"truncate": truncateText,
+		"date": func(layout string, value any) string {
+			t, ok := value.(time.Time)
+			if !ok {
+				return ""
+			}
+			return t.Local().Format(layout)
+		},
+		"join": func(sep string, value any) string {
+			return strings.Join(stringSlice(value), sep)
+		},
+		"color": func(name string, value any) (string, error) {
+			code, ok := ansiColors[name]
+			if !ok {
+				return "", fmt.Errorf("unknown color %s", name)
+			}
+			return colorize(useColor, code, value), nil
+		},
+		"bold": func(value any) string {
+			return colorize(useColor, ansiColors["bold"], value)
+		},
+		"dim": func(value any) string {
+			return colorize(useColor, ansiColors["dim"], value)
+		},
+	}
+
+	tmpl, err := template.New("output").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing output template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// colorEnabled reports whether color functions should emit escape codes:
+// only when stdout is a terminal and NO_COLOR isn't set.
+func colorEnabled() bool {
+	return os.Getenv("NO_COLOR") == "" && stdoutIsTerminal()
+}
+
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func colorize(useColor bool, code string, value any) string {
+	text := textValue(value, time.DateTime)
+	if !useColor || text == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// relativeTime renders a time as a short age like "5m ago" or "3d ago".
+func relativeTime(value any) string {
+	t, ok := value.(time.Time)
+	if !ok {
+		return ""
+	}
+
+	age := time.Since(t)
+	switch {
+	case age < 0:
+		return "in the future"
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	case age < 30*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	case age < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(age.Hours()/24/30))
+	}
+	return fmt.Sprintf("%dy ago", int(age.Hours()/24/365))
+}
+
+// truncateText shortens a value to at most width characters, marking the cut
+// with an ellipsis. Its argument order lets it sit at the end of a pipeline:
+// {{.title | truncate 40}}.
+func truncateText(width int, value any) string {
+	text := textValue(value, time.DateTime)
+	if width <= 0 || utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	return string([]rune(text)[:width-1]) + "…"
+}
+
+func stringSlice(value any) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case nil:
+		return nil
+	}
+	return []string{textValue(value, time.DateTime)}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{now.Add(time.Hour), "in the future"},
+		{now.Add(-10 * time.Second), "just now"},
+		{now.Add(-5 * time.Minute), "5m ago"},
+		{now.Add(-3 * time.Hour), "3h ago"},
+		{now.Add(-4 * 24 * time.Hour), "4d ago"},
+		{now.Add(-65 * 24 * time.Hour), "2mo ago"},
+		{now.Add(-800 * 24 * time.Hour), "2y ago"},
+		{nil, ""},
+		{"2024-01-31", ""},
+	}
+
+	for _, tt := range tests {
+		if got := relativeTime(tt.value); got != tt.want {
+			t.Errorf("relativeTime(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		width int
+		value any
+		want  string
+	}{
+		{10, "short", "short"},
+		{5, "exact", "exact"},
+		{5, "too long", "too …"},
+		{3, "ünïcode", "ün…"},
+		{0, "no limit", "no limit"},
+		{4, 123456, "123…"},
+		{4, sql.NullString{}, ""},
+		{6, []string{"a", "b", "c", "d"}, "a,b,c…"},
+	}
+
+	for _, tt := range tests {
+		if got := truncateText(tt.width, tt.value); got != tt.want {
+			t.Errorf("truncateText(%d, %v) = %q, want %q", tt.width, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseOutputTemplate(t *testing.T) {
+	published := time.Date(2024, 1, 31, 12, 0, 0, 0, time.Local)
+	row := map[string]any{
+		"title":        "Hello",
+		"published_at": published,
+		"tags":         []string{"go", "db"},
+	}
+
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{`{{.title | truncate 4}}`, "Hel…", false},
+		{`{{date "2006-01-02" .published_at}}`, "2024-01-31", false},
+		{`{{join "+" .tags}}`, "go+db", false},
+		{`{{bold .title}}`, "Hello", false},
+		{`{{color "pink" .title}}`, "", true},
+		{`{{.title`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			tmpl, err := parseOutputTemplate(tt.text, "browse")
+			if err == nil {
+				var out strings.Builder
+				err = tmpl.Execute(&out, row)
+				if err == nil && out.String() != tt.want {
+					t.Errorf("template %q = %q, want %q", tt.text, out.String(), tt.want)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("template %q error = %v, want error %v", tt.text, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuiltinTemplatesOnlyForPostListings(t *testing.T) {
+	for name := range builtinTemplates {
+		for _, command := range builtinTemplateCommands {
+			_, err := parseOutputTemplate(name, command)
+			if err != nil {
+				t.Errorf("built-in %s with %s: %v", name, command, err)
+			}
+		}
+		for _, command := range []string{"following", "rule ls", "notify log"} {
+			_, err := parseOutputTemplate(name, command)
+			if err == nil {
+				t.Errorf("built-in %s with %s: want an error", name, command)
+			}
+		}
+	}
+}
+
+func TestTemplateCommandName(t *testing.T) {
+	tests := []struct {
+		cmdName string
+		args    []string
+		want    string
+	}{
+		{"browse", []string{"10"}, "browse"},
+		{"rule", []string{"ls"}, "rule ls"},
+		{"rule", []string{"test", "--field", "title", "go"}, "rule test"},
+		{"notify", []string{"log", "--limit", "5"}, "notify log"},
+		{"feeds", nil, "feeds"},
+		{"feeds", []string{"gc", "--dry-run"}, "feeds gc"},
+		{"notify", []string{"--help"}, "notify"},
+	}
+
+	for _, tt := range tests {
+		if got := templateCommandName(tt.cmdName, tt.args); got != tt.want {
+			t.Errorf("templateCommandName(%s, %q) = %q, want %q", tt.cmdName, tt.args, got, tt.want)
+		}
+	}
+}
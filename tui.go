@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/d-shames3/gator/internal/htmltext"
+	"github.com/google/uuid"
+)
+
+type tuiPane int
+
+const (
+	feedsPane tuiPane = iota
+	postsPane
+	readerPane
+)
+
+// tuiPostLimit caps how many posts are loaded into the post list at once.
+const tuiPostLimit = 200
+
+// tui holds the screen state for handlerTUI. The first entry in the feed
+// list is a synthetic "All feeds" row, so feedIdx 0 means no feed filter.
+type tui struct {
+	s      *state
+	user   database.User
+	screen *bufio.Writer
+
+	feeds   []database.GetFeedFollowsForUserRow
+	posts   []database.GetPostsForUserRow
+	feedIdx int
+	postIdx int
+	scroll  int
+	focus   tuiPane
+	status  string
+
+	width  int
+	height int
+}
+
+func handlerTUI(s *state, cmd command, user database.User) error {
+	savedTTY, err := stty("-g")
+	if err != nil {
+		return fmt.Errorf("tui needs an interactive terminal: %v", err)
+	}
+
+	_, err = stty("raw", "-echo")
+	if err != nil {
+		return fmt.Errorf("error switching terminal to raw mode: %v", err)
+	}
+	defer stty(strings.TrimSpace(savedTTY))
+
+	// scrapeFeed reports progress on stdout, which would scribble over the
+	// screen during a refresh, so draw to the real stdout and send anything
+	// else to /dev/null while the tui is up.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	t := &tui{
+		s:      s,
+		user:   user,
+		screen: bufio.NewWriter(stdout),
+	}
+
+	fmt.Fprint(t.screen, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(t.screen, "\x1b[?25h\x1b[?1049l")
+		t.screen.Flush()
+	}()
+
+	err = t.loadFeeds()
+	if err != nil {
+		return err
+	}
+	err = t.loadPosts()
+	if err != nil {
+		return err
+	}
+
+	keys := make(chan string)
+	go readKeys(keys)
+
+	for {
+		t.resize()
+		t.draw()
+
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			quit, err := t.handleKey(key)
+			if err != nil {
+				t.status = err.Error()
+			}
+			if quit {
+				return nil
+			}
+		}
+	}
+}
+
+func (t *tui) handleKey(key string) (bool, error) {
+	t.status = ""
+	switch key {
+	case "q", "\x03":
+		return true, nil
+	case "\t", "l", "right":
+		if t.focus < readerPane {
+			t.focus++
+		}
+	case "h", "left", "esc":
+		if t.focus > feedsPane {
+			t.focus--
+		}
+	case "j", "down":
+		return false, t.move(1)
+	case "k", "up":
+		return false, t.move(-1)
+	case "enter":
+		if t.focus == feedsPane {
+			t.focus = postsPane
+		} else if t.focus == postsPane && len(t.posts) > 0 {
+			t.focus = readerPane
+			t.scroll = 0
+			return false, t.setRead(true)
+		}
+	case "r":
+		if post, ok := t.currentPost(); ok {
+			return false, t.setRead(!post.ReadAt.Valid)
+		}
+	case "s":
+		return false, t.toggleStar()
+	case "R":
+		return false, t.refresh()
+	}
+	return false, nil
+}
+
+func (t *tui) move(delta int) error {
+	switch t.focus {
+	case feedsPane:
+		next := clamp(t.feedIdx+delta, 0, len(t.feeds))
+		if next != t.feedIdx {
+			t.feedIdx = next
+			t.postIdx = 0
+			return t.loadPosts()
+		}
+	case postsPane:
+		t.postIdx = clamp(t.postIdx+delta, 0, len(t.posts)-1)
+		t.scroll = 0
+	case readerPane:
+		t.scroll = max(t.scroll+delta, 0)
+	}
+	return nil
+}
+
+func (t *tui) loadFeeds() error {
+	feeds, err := t.s.db.GetFeedFollowsForUser(t.s.ctx, t.user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching followed feeds: %v", err)
+	}
+	t.feeds = feeds
+	t.feedIdx = clamp(t.feedIdx, 0, len(t.feeds))
+	return nil
+}
+
+func (t *tui) loadPosts() error {
+	postParams := database.GetPostsForUserParams{
+		UserID:   t.user.ID,
+		SortBy:   "published",
+		RowLimit: tuiPostLimit,
+	}
+	if t.feedIdx > 0 {
+		postParams.FeedID = uuid.NullUUID{UUID: t.feeds[t.feedIdx-1].FeedID, Valid: true}
+	}
+
+	posts, err := t.s.db.GetPostsForUser(t.s.ctx, postParams)
+	if err != nil {
+		return fmt.Errorf("error fetching posts: %v", err)
+	}
+	t.posts = posts
+	t.postIdx = clamp(t.postIdx, 0, len(t.posts)-1)
+	return nil
+}
+
+func (t *tui) currentPost() (database.GetPostsForUserRow, bool) {
+	if len(t.posts) == 0 {
+		return database.GetPostsForUserRow{}, false
+	}
+	return t.posts[t.postIdx], true
+}
+
+func (t *tui) setRead(read bool) error {
+	post, ok := t.currentPost()
+	if !ok {
+		return nil
+	}
+
+	var err error
+	if read {
+		err = t.s.db.MarkPostRead(t.s.ctx, database.MarkPostReadParams{UserID: t.user.ID, PostID: post.ID})
+	} else {
+		err = t.s.db.MarkPostUnread(t.s.ctx, database.MarkPostUnreadParams{UserID: t.user.ID, PostID: post.ID})
+	}
+	if err != nil {
+		return fmt.Errorf("error updating post %d: %v", post.ShortID, err)
+	}
+
+	t.posts[t.postIdx].ReadAt.Valid = read
+	return t.loadFeeds()
+}
+
+func (t *tui) toggleStar() error {
+	post, ok := t.currentPost()
+	if !ok {
+		return nil
+	}
+
+	var err error
+	if post.StarredAt.Valid {
+		err = t.s.db.UnstarPost(t.s.ctx, database.UnstarPostParams{UserID: t.user.ID, PostID: post.ID})
+	} else {
+		err = t.s.db.StarPost(t.s.ctx, database.StarPostParams{UserID: t.user.ID, PostID: post.ID})
+	}
+	if err != nil {
+		return fmt.Errorf("error updating post %d: %v", post.ShortID, err)
+	}
+
+	t.posts[t.postIdx].StarredAt.Valid = !post.StarredAt.Valid
+	return nil
+}
+
+// refresh fetches the selected feed, or every followed feed when "All feeds"
+// is selected, then reloads both lists.
+func (t *tui) refresh() error {
+	followed := t.feeds
+	if t.feedIdx > 0 {
+		followed = t.feeds[t.feedIdx-1 : t.feedIdx]
+	}
+
+	t.status = "Refreshing..."
+	t.draw()
+
+	for _, follow := range followed {
+		feed, err := t.s.db.GetFeedByURLOrName(t.s.ctx, follow.Url)
+		if err != nil {
+			return fmt.Errorf("error fetching feed %s: %v", follow.Feed, err)
+		}
+		err = fetchNow(t.s, feed)
+		if err != nil {
+			return err
+		}
+	}
+
+	t.status = fmt.Sprintf("Refreshed %d feeds", len(followed))
+	err := t.loadFeeds()
+	if err != nil {
+		return err
+	}
+	return t.loadPosts()
+}
+
+func (t *tui) resize() {
+	t.width, t.height = 80, 24
+	cols, rows, ok := terminalSize()
+	if ok {
+		t.width, t.height = cols, rows
+	}
+}
+
+// terminalSize asks stty for the terminal's size in columns and rows.
+func terminalSize() (int, int, bool) {
+	size, err := stty("size")
+	if err != nil {
+		return 0, 0, false
+	}
+	fields := strings.Fields(size)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	rows, errRows := strconv.Atoi(fields[0])
+	cols, errCols := strconv.Atoi(fields[1])
+	if errRows != nil || errCols != nil || rows <= 0 || cols <= 0 {
+		return 0, 0, false
+	}
+	return cols, rows, true
+}
+
+// draw repaints the whole screen: feeds on the left, posts top right, the
+// selected post bottom right, and a status/help line at the bottom.
+func (t *tui) draw() {
+	feedsWidth := max(t.width/4, 16)
+	rightWidth := t.width - feedsWidth - 1
+	bodyHeight := t.height - 1
+	postsHeight := bodyHeight / 2
+	readerHeight := bodyHeight - postsHeight - 1
+
+	fmt.Fprint(t.screen, "\x1b[H\x1b[2J")
+
+	feedLines := []string{"All feeds"}
+	for _, feed := range t.feeds {
+		feedLines = append(feedLines, fmt.Sprintf("%s (%d)", feed.Feed, feed.Unread))
+	}
+	t.drawList(1, 1, feedsWidth, bodyHeight, feedLines, t.feedIdx, t.focus == feedsPane)
+
+	for row := 1; row <= bodyHeight; row++ {
+		fmt.Fprintf(t.screen, "\x1b[%d;%dH│", row, feedsWidth+1)
+	}
+
+	postLines := make([]string, 0, len(t.posts))
+	for _, post := range t.posts {
+		marker := "  "
+		if !post.ReadAt.Valid {
+			marker = "● "
+		}
+		if post.StarredAt.Valid {
+			marker = "★ "
+		}
+		postLines = append(postLines, fmt.Sprintf("%s%-6d %s — %s", marker, post.ShortID, post.PostTitle, post.FeedName))
+	}
+	t.drawList(1, feedsWidth+2, rightWidth, postsHeight, postLines, t.postIdx, t.focus == postsPane)
+
+	fmt.Fprintf(t.screen, "\x1b[%d;%dH%s", postsHeight+1, feedsWidth+2, strings.Repeat("─", max(rightWidth, 0)))
+
+	var readerLines []string
+	if post, ok := t.currentPost(); ok {
+		readerLines = append(readerLines, "\x1b[1m"+terminalSafe(post.PostTitle)+"\x1b[0m", terminalSafe(post.Url))
+		publishedAt := post.CreatedAt
+		if post.PublishedAt.Valid {
+			publishedAt = post.PublishedAt.Time
+		}
+		readerLines = append(readerLines, fmt.Sprintf("%s · %v", terminalSafe(post.FeedName), publishedAt.Format("2006-01-02 15:04")), "")
+		// fitWidth can't skip over OSC 8 sequences, so no hyperlinks here.
+		body := htmltext.Render(post.Description.String, htmltext.Options{Width: rightWidth})
+		readerLines = append(readerLines, strings.Split(body, "\n")...)
+	}
+	t.scroll = clamp(t.scroll, 0, len(readerLines)-1)
+	for i := 0; i < readerHeight && t.scroll+i < len(readerLines); i++ {
+		fmt.Fprintf(t.screen, "\x1b[%d;%dH%s", postsHeight+2+i, feedsWidth+2, fitWidth(readerLines[t.scroll+i], rightWidth))
+	}
+
+	help := "tab/h/l: switch pane  j/k: move  enter: open  r: read/unread  s: star  R: refresh  q: quit"
+	if t.status != "" {
+		help = t.status + "  |  " + help
+	}
+	fmt.Fprintf(t.screen, "\x1b[%d;1H\x1b[7m%s\x1b[0m", t.height, fitWidth(help, t.width))
+	t.screen.Flush()
+}
+
+// drawList draws lines in a box starting at (row, col), keeping the selected
+// line in view and highlighting it when the pane has focus.
+func (t *tui) drawList(row, col, width, height int, lines []string, selected int, focused bool) {
+	offset := 0
+	if selected >= height {
+		offset = selected - height + 1
+	}
+	for i := 0; i < height && offset+i < len(lines); i++ {
+		line := fitWidth(terminalSafe(lines[offset+i]), width)
+		if offset+i == selected {
+			if focused {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			} else {
+				line = "\x1b[1m" + line + "\x1b[0m"
+			}
+		}
+		fmt.Fprintf(t.screen, "\x1b[%d;%dH%s", row+i, col, line)
+	}
+}
+
+// readKeys turns raw stdin bytes into key names, closing keys on EOF.
+func readKeys(keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		input := string(buf[:n])
+		switch input {
+		case "\x1b[A":
+			keys <- "up"
+		case "\x1b[B":
+			keys <- "down"
+		case "\x1b[C":
+			keys <- "right"
+		case "\x1b[D":
+			keys <- "left"
+		case "\x1b":
+			keys <- "esc"
+		case "\r", "\n":
+			keys <- "enter"
+		default:
+			for _, r := range input {
+				keys <- string(r)
+			}
+		}
+	}
+}
+
+// stty runs stty against the controlling terminal and returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// hyperlinksSupported guesses whether the terminal on stdout understands OSC
+// 8 hyperlinks. There's no way to ask, so this goes by the environment
+// variables of terminals known to support them; anything else gets plain
+// text and footnotes only.
+func hyperlinksSupported() bool {
+	if !stdoutIsTerminal() || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	switch os.Getenv("TERM_PROGRAM") {
+	case "iTerm.app", "WezTerm", "vscode", "ghostty":
+		return true
+	}
+	if version, err := strconv.Atoi(os.Getenv("VTE_VERSION")); err == nil && version >= 5000 {
+		return true
+	}
+	return os.Getenv("KITTY_WINDOW_ID") != "" || os.Getenv("WT_SESSION") != ""
+}
+
+// terminalSafe drops control characters so feed content can't move the
+// cursor or inject escape sequences into the screen.
+func terminalSafe(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// fitWidth truncates text to width runes, ignoring escape sequences the tui
+// itself added.
+func fitWidth(text string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	visible := 0
+	inEscape := false
+	for _, r := range text {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r >= '@' && r <= '~' && r != '[' {
+				inEscape = false
+			}
+		case visible >= width:
+			continue
+		default:
+			visible++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func clamp(value, low, high int) int {
+	if value > high {
+		value = high
+	}
+	if value < low {
+		value = low
+	}
+	return value
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/d-shames3/gator/internal/database"
+	"github.com/google/uuid"
+)
+
+// userArchiveVersion is the version of the archive format export user
+// writes. Bump it when the format changes in a way older versions of import
+// user can't read, and keep import able to read older versions.
+const userArchiveVersion = 1
+
+// userArchive is everything gator keeps for one user. Feeds and posts are
+// identified by url so an archive can be restored into another database.
+type userArchive struct {
+	Version     int                 `json:"version"`
+	ExportedAt  time.Time           `json:"exported_at"`
+	User        archiveUser         `json:"user"`
+	Follows     []archiveFollow     `json:"follows"`
+	Posts       []archivePost       `json:"posts"`
+	Rules       []archiveRule       `json:"rules"`
+	NotifySinks []archiveNotifySink `json:"notify_sinks"`
+}
+
+type archiveUser struct {
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Email           string     `json:"email,omitempty"`
+	DigestFrequency string     `json:"digest_frequency,omitempty"`
+	LastDigestAt    *time.Time `json:"last_digest_at,omitempty"`
+}
+
+type archiveFollow struct {
+	FeedURL    string    `json:"feed_url"`
+	FeedName   string    `json:"feed_name"`
+	Folder     string    `json:"folder,omitempty"`
+	Alias      string    `json:"alias,omitempty"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type archivePost struct {
+	FeedURL      string     `json:"feed_url"`
+	FeedName     string     `json:"feed_name"`
+	URL          string     `json:"url"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description,omitempty"`
+	Author       string     `json:"author,omitempty"`
+	CommentsURL  string     `json:"comments_url,omitempty"`
+	Categories   []string   `json:"categories,omitempty"`
+	PublishedAt  *time.Time `json:"published_at,omitempty"`
+	ReadAt       *time.Time `json:"read_at,omitempty"`
+	StarredAt    *time.Time `json:"starred_at,omitempty"`
+	QueuedAt     *time.Time `json:"queued_at,omitempty"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	HiddenAt     *time.Time `json:"hidden_at,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+}
+
+type archiveRule struct {
+	FeedURL   string `json:"feed_url,omitempty"`
+	FeedName  string `json:"feed_name,omitempty"`
+	Field     string `json:"field"`
+	MatchType string `json:"match_type"`
+	Pattern   string `json:"pattern"`
+	Action    string `json:"action"`
+	Tag       string `json:"tag,omitempty"`
+}
+
+type archiveNotifySink struct {
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+	Keyword string `json:"keyword,omitempty"`
+}
+
+func archiveTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func unarchiveTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func exportUser(s *state, user database.User, args []string) error {
+	exportFlags := flag.NewFlagSet("export user", flag.ContinueOnError)
+	out := exportFlags.String("out", "", "write to this file instead of stdout")
+	err := parseFlags(exportFlags, args)
+	if err != nil {
+		return err
+	}
+
+	archive := userArchive{
+		Version:    userArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		User: archiveUser{
+			Name:            user.Name,
+			CreatedAt:       user.CreatedAt,
+			Email:           user.Email.String,
+			DigestFrequency: user.DigestFrequency.String,
+			LastDigestAt:    archiveTime(user.LastDigestAt),
+		},
+		Follows:     []archiveFollow{},
+		Posts:       []archivePost{},
+		Rules:       []archiveRule{},
+		NotifySinks: []archiveNotifySink{},
+	}
+
+	follows, err := s.db.GetFollowsForExport(s.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching follows for user %s: %v", user.Name, err)
+	}
+	for _, follow := range follows {
+		archive.Follows = append(archive.Follows, archiveFollow{
+			FeedURL:    follow.Url,
+			FeedName:   follow.Name,
+			Folder:     follow.Folder.String,
+			Alias:      follow.Alias.String,
+			FollowedAt: follow.CreatedAt,
+		})
+	}
+
+	posts, err := s.db.GetPostStatesForExport(s.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching post states for user %s: %v", user.Name, err)
+	}
+	for _, post := range posts {
+		archive.Posts = append(archive.Posts, archivePost{
+			FeedURL:      post.FeedUrl,
+			FeedName:     post.FeedName,
+			URL:          post.Url,
+			Title:        post.Title,
+			Description:  post.Description.String,
+			Author:       post.Author.String,
+			CommentsURL:  post.CommentsUrl.String,
+			Categories:   post.Categories,
+			PublishedAt:  archiveTime(post.PublishedAt),
+			ReadAt:       archiveTime(post.ReadAt),
+			StarredAt:    archiveTime(post.StarredAt),
+			QueuedAt:     archiveTime(post.QueuedAt),
+			SnoozedUntil: archiveTime(post.SnoozedUntil),
+			HiddenAt:     archiveTime(post.HiddenAt),
+			Tags:         post.Tags,
+		})
+	}
+
+	rules, err := s.db.GetRulesForUser(s.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching rules for user %s: %v", user.Name, err)
+	}
+	for _, rule := range rules {
+		archive.Rules = append(archive.Rules, archiveRule{
+			FeedURL:   rule.FeedUrl.String,
+			FeedName:  rule.Feed.String,
+			Field:     rule.Field,
+			MatchType: rule.MatchType,
+			Pattern:   rule.Pattern,
+			Action:    rule.Action,
+			Tag:       rule.Tag.String,
+		})
+	}
+
+	sinks, err := s.db.GetNotifySinksForUser(s.ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("error fetching notification sinks for user %s: %v", user.Name, err)
+	}
+	for _, sink := range sinks {
+		archive.NotifySinks = append(archive.NotifySinks, archiveNotifySink{
+			Kind:    sink.Kind,
+			Target:  sink.Target,
+			Keyword: sink.Keyword.String,
+		})
+	}
+
+	encoded, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding archive: %v", err)
+	}
+	encoded = append(encoded, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(encoded)
+		return err
+	}
+	// The archive can hold webhook urls with secrets in them, so keep it
+	// private.
+	err = os.WriteFile(*out, encoded, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", *out, err)
+	}
+	fmt.Printf("Exported user %s to %s: %d follows, %d posts, %d rules, %d notification sinks\n",
+		user.Name, *out, len(archive.Follows), len(archive.Posts), len(archive.Rules), len(archive.NotifySinks))
+	return nil
+}
+
+// importUser restores an archive written by export user, creating the user
+// if needed. Everything is merged into what the user already has, so
+// importing the same archive again changes nothing.
+func importUser(s *state, args []string) error {
+	importFlags := flag.NewFlagSet("import user", flag.ContinueOnError)
+	as := importFlags.String("as", "", "import into this user instead of the one in the archive")
+	allowExec := importFlags.Bool("allow-exec", false, "also restore exec notification sinks, which run shell commands")
+	err := parseFlags(importFlags, args)
+	if err != nil {
+		return err
+	}
+	if importFlags.NArg() != 1 {
+		return fmt.Errorf("usage: import user [--as <name>] [--allow-exec] <file>")
+	}
+
+	data, err := readImportFile(importFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var archive userArchive
+	err = json.Unmarshal(data, &archive)
+	if err != nil {
+		return fmt.Errorf("error parsing archive: %v", err)
+	}
+	if archive.Version < 1 || archive.Version > userArchiveVersion {
+		return fmt.Errorf("unsupported archive version %d, this gator reads versions 1 to %d", archive.Version, userArchiveVersion)
+	}
+
+	name := archive.User.Name
+	if *as != "" {
+		name = *as
+	}
+	if name == "" {
+		return fmt.Errorf("archive has no user name, use --as to pick one")
+	}
+
+	tx, err := s.sqlDB.BeginTx(s.ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+
+	user, err := qtx.GetUser(s.ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		now := time.Now()
+		user, err = qtx.CreateUser(s.ctx, database.CreateUserParams{
+			ID:        uuid.New(),
+			CreatedAt: now,
+			UpdatedAt: now,
+			Name:      name,
+		})
+		if err != nil {
+			return fmt.Errorf("error creating user %s: %v", name, err)
+		}
+		fmt.Printf("Created user %s\n", name)
+	} else if err != nil {
+		return fmt.Errorf("error fetching user %s: %v", name, err)
+	}
+
+	err = importUserPreferences(s, qtx, user, archive.User)
+	if err != nil {
+		return err
+	}
+
+	subs := make([]subscription, 0, len(archive.Follows))
+	for _, follow := range archive.Follows {
+		subs = append(subs, subscription{url: follow.FeedURL, title: follow.FeedName, folder: follow.Folder})
+	}
+	changes, err := planSubscriptions(s, qtx, user, subs)
+	if err != nil {
+		return err
+	}
+	err = applySubscriptions(s, qtx, user, changes)
+	if err != nil {
+		return err
+	}
+	feedIDs := subscriptionFeedIDs(changes)
+	newFollows := 0
+	for _, change := range changes {
+		if change.action == "create" || change.action == "follow" {
+			newFollows++
+		}
+	}
+
+	for _, follow := range archive.Follows {
+		feedID, ok := feedIDs[follow.FeedURL]
+		if !ok || follow.Alias == "" {
+			continue
+		}
+		_, err := qtx.SetFeedFollowAlias(s.ctx, database.SetFeedFollowAliasParams{
+			UserID: user.ID,
+			FeedID: feedID,
+			Alias:  sql.NullString{String: follow.Alias, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error restoring name of feed %s: %v", follow.FeedURL, err)
+		}
+	}
+
+	// Starred posts can outlive the follow of their feed, so posts and
+	// rules may need feeds the user no longer follows.
+	posts := make([]importedPost, 0, len(archive.Posts))
+	for _, post := range archive.Posts {
+		_, err := ensureFeed(s, qtx, user, feedIDs, post.FeedURL, post.FeedName)
+		if err != nil {
+			return err
+		}
+		posts = append(posts, importedPost{
+			feedURL:      post.FeedURL,
+			url:          post.URL,
+			title:        post.Title,
+			description:  post.Description,
+			author:       post.Author,
+			commentsURL:  post.CommentsURL,
+			categories:   post.Categories,
+			publishedAt:  unarchiveTime(post.PublishedAt),
+			readAt:       unarchiveTime(post.ReadAt),
+			starredAt:    unarchiveTime(post.StarredAt),
+			queuedAt:     unarchiveTime(post.QueuedAt),
+			snoozedUntil: unarchiveTime(post.SnoozedUntil),
+			hiddenAt:     unarchiveTime(post.HiddenAt),
+			tags:         post.Tags,
+		})
+	}
+	newPosts, states, err := importPosts(s, qtx, user, feedIDs, uniquePosts(posts))
+	if err != nil {
+		return err
+	}
+
+	newRules, err := importUserRules(s, qtx, user, feedIDs, archive.Rules)
+	if err != nil {
+		return err
+	}
+
+	newSinks, skippedExec, err := importUserSinks(s, qtx, user, archive.NotifySinks, *allowExec)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing import: %v", err)
+	}
+
+	fmt.Printf("Imported user %s: %d follows (%d new), %d posts (%d new, %d with state), %d rules (%d new), %d notification sinks (%d new)\n",
+		user.Name, len(archive.Follows), newFollows, len(posts), newPosts, states,
+		len(archive.Rules), newRules, len(archive.NotifySinks), newSinks)
+	if skippedExec > 0 {
+		fmt.Printf("Skipped %d exec notification sinks, rerun with --allow-exec to restore them\n", skippedExec)
+	}
+	if s.config.CurrentUserName != user.Name {
+		fmt.Printf("Run \"gator login %s\" to use it\n", user.Name)
+	}
+	return nil
+}
+
+// importUserPreferences restores the digest settings from the archive unless
+// the user has their own, and moves the last digest time forward so digests
+// aren't sent twice.
+func importUserPreferences(s *state, db *database.Queries, user database.User, prefs archiveUser) error {
+	if prefs.Email != "" && !user.Email.Valid {
+		if prefs.DigestFrequency != "" {
+			if _, ok := digestFrequencies[prefs.DigestFrequency]; !ok {
+				return fmt.Errorf("archive has unknown digest frequency %s", prefs.DigestFrequency)
+			}
+		}
+		err := db.SetUserDigest(s.ctx, database.SetUserDigestParams{
+			ID:              user.ID,
+			Email:           sql.NullString{String: prefs.Email, Valid: true},
+			DigestFrequency: sql.NullString{String: prefs.DigestFrequency, Valid: prefs.DigestFrequency != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("error restoring digest settings: %v", err)
+		}
+	}
+
+	if prefs.LastDigestAt != nil && (!user.LastDigestAt.Valid || user.LastDigestAt.Time.Before(*prefs.LastDigestAt)) {
+		err := db.MarkDigestSent(s.ctx, database.MarkDigestSentParams{
+			ID:           user.ID,
+			LastDigestAt: sql.NullTime{Time: *prefs.LastDigestAt, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error restoring last digest time: %v", err)
+		}
+	}
+	return nil
+}
+
+// ensureFeed returns the id of the feed with feedURL, adding the feed if
+// gator doesn't have it. Ids are cached in feedIDs.
+func ensureFeed(s *state, db *database.Queries, user database.User, feedIDs map[string]uuid.UUID, feedURL, name string) (uuid.UUID, error) {
+	if feedID, ok := feedIDs[feedURL]; ok {
+		return feedID, nil
+	}
+
+	feed, err := db.GetFeed(s.ctx, feedURL)
+	if err == nil {
+		feedIDs[feedURL] = feed.ID
+		return feed.ID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, fmt.Errorf("error fetching feed %s: %v", feedURL, err)
+	}
+
+	if name == "" {
+		name = feedURL
+	}
+	now := time.Now()
+	created, err := db.CreateFeed(s.ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+		Url:       feedURL,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("error adding feed %s: %v", feedURL, err)
+	}
+	feedIDs[feedURL] = created.ID
+	return created.ID, nil
+}
+
+// importUserRules adds the archive's rules the user doesn't already have
+// and returns how many were added.
+func importUserRules(s *state, db *database.Queries, user database.User, feedIDs map[string]uuid.UUID, rules []archiveRule) (int, error) {
+	existing, err := db.GetRulesForUser(s.ctx, user.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching rules for user %s: %v", user.Name, err)
+	}
+	have := make(map[archiveRule]bool, len(existing))
+	for _, rule := range existing {
+		have[archiveRule{
+			FeedURL:   rule.FeedUrl.String,
+			Field:     rule.Field,
+			MatchType: rule.MatchType,
+			Pattern:   rule.Pattern,
+			Action:    rule.Action,
+			Tag:       rule.Tag.String,
+		}] = true
+	}
+
+	added := 0
+	for _, rule := range rules {
+		if !slices.Contains(ruleFields, rule.Field) || !slices.Contains(ruleActions, rule.Action) {
+			return 0, fmt.Errorf("archive has an invalid rule matching %s to %s", rule.Field, rule.Action)
+		}
+		_, err := compileRule(database.Rule{MatchType: rule.MatchType, Pattern: rule.Pattern})
+		if err != nil {
+			return 0, err
+		}
+
+		key := rule
+		key.FeedName = ""
+		if have[key] {
+			continue
+		}
+		have[key] = true
+
+		params := database.CreateRuleParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			Field:     rule.Field,
+			MatchType: rule.MatchType,
+			Pattern:   rule.Pattern,
+			Action:    rule.Action,
+			Tag:       sql.NullString{String: rule.Tag, Valid: rule.Tag != ""},
+		}
+		if rule.FeedURL != "" {
+			feedID, err := ensureFeed(s, db, user, feedIDs, rule.FeedURL, rule.FeedName)
+			if err != nil {
+				return 0, err
+			}
+			params.FeedID = uuid.NullUUID{UUID: feedID, Valid: true}
+		}
+
+		_, err = db.CreateRule(s.ctx, params)
+		if err != nil {
+			return 0, fmt.Errorf("error creating rule: %v", err)
+		}
+		added++
+	}
+	return added, nil
+}
+
+// importUserSinks adds the archive's notification sinks the user doesn't
+// already have. Exec sinks run shell commands, so they are only restored
+// when allowExec is set. It returns how many sinks were added and how many
+// exec sinks were skipped.
+func importUserSinks(s *state, db *database.Queries, user database.User, sinks []archiveNotifySink, allowExec bool) (int, int, error) {
+	existing, err := db.GetNotifySinksForUser(s.ctx, user.ID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error fetching notification sinks for user %s: %v", user.Name, err)
+	}
+	have := make(map[archiveNotifySink]bool, len(existing))
+	for _, sink := range existing {
+		have[archiveNotifySink{Kind: sink.Kind, Target: sink.Target, Keyword: sink.Keyword.String}] = true
+	}
+
+	added, skipped := 0, 0
+	for _, sink := range sinks {
+		if have[sink] {
+			continue
+		}
+		if !slices.Contains(notifyKinds, sink.Kind) {
+			return 0, 0, fmt.Errorf("archive has a notification sink of unknown kind %s", sink.Kind)
+		}
+		err := validateNotifyTarget(sink.Kind, sink.Target)
+		if err != nil {
+			return 0, 0, err
+		}
+		if sink.Kind == "exec" && !allowExec {
+			skipped++
+			continue
+		}
+		have[sink] = true
+
+		_, err = db.CreateNotifySink(s.ctx, database.CreateNotifySinkParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			Kind:      sink.Kind,
+			Target:    sink.Target,
+			Keyword:   sql.NullString{String: sink.Keyword, Valid: sink.Keyword != ""},
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("error creating notification sink: %v", err)
+		}
+		added++
+	}
+	return added, skipped, nil
+}